@@ -0,0 +1,215 @@
+package commander
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/teris-io/shortid"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+var (
+	// ErrQueueFull is returned by AsyncCommander.TrySubmit when there is no room left in the queue.
+	ErrQueueFull = errors.New("the async commander queue is full")
+
+	// ErrAsyncCommanderClosed is returned when a command is submitted after AsyncCommander.Shutdown was called.
+	ErrAsyncCommanderClosed = errors.New("the async commander is shut down")
+)
+
+// Future is a handle to the outcome of a command submitted to an AsyncCommander.
+type Future struct {
+	done   chan struct{}
+	result any
+	err    error
+}
+
+// Done returns a channel that is closed once the command has finished executing.
+func (future *Future) Done() <-chan struct{} {
+	return future.done
+}
+
+// Wait blocks until the command has finished executing and returns its result, or until ctx is done.
+// Giving up on the wait does not cancel the command.
+func (future *Future) Wait(ctx context.Context) (any, error) {
+	select {
+	case <-future.done:
+		return future.result, future.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (future *Future) resolve(result any, err error) {
+	future.result = result
+	future.err = err
+	close(future.done)
+}
+
+type asyncJob struct {
+	ctx     context.Context
+	command Command
+	future  *Future
+}
+
+// AsyncCommander queues commands and executes them on a bounded pool of workers. The commands run
+// with a context detached from the caller's, so they are not cancelled when the caller returns,
+// but they keep the caller's logger and correlation id.
+type AsyncCommander struct {
+	executor     Executor
+	queue        chan *asyncJob
+	closing      chan struct{}
+	mutex        sync.RWMutex
+	shutdownOnce sync.Once
+	workers      sync.WaitGroup
+}
+
+// NewAsyncCommander starts an AsyncCommander with the given number of workers that execute commands
+// with executor. queueSize is the number of commands that can wait for a free worker before
+// submissions start to block. Call Shutdown to stop the workers.
+func NewAsyncCommander(executor Executor, workers int, queueSize int) *AsyncCommander {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	asyncCommander := &AsyncCommander{
+		executor: executor,
+		queue:    make(chan *asyncJob, queueSize),
+		closing:  make(chan struct{}),
+	}
+
+	asyncCommander.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go asyncCommander.work()
+	}
+
+	return asyncCommander
+}
+
+// Submit queues the command for execution and returns a Future for its outcome. If the queue is full,
+// Submit blocks until there is room, ctx is done or the AsyncCommander is shut down.
+func (asyncCommander *AsyncCommander) Submit(ctx context.Context, command Command) (*Future, error) {
+	asyncCommander.mutex.RLock()
+	defer asyncCommander.mutex.RUnlock()
+
+	if asyncCommander.isClosing() {
+		return nil, ErrAsyncCommanderClosed
+	}
+
+	job := newAsyncJob(ctx, command)
+
+	select {
+	case asyncCommander.queue <- job:
+		return job.future, nil
+	case <-asyncCommander.closing:
+		return nil, ErrAsyncCommanderClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TrySubmit queues the command for execution like Submit, but returns ErrQueueFull instead of blocking
+// when the queue is full.
+func (asyncCommander *AsyncCommander) TrySubmit(ctx context.Context, command Command) (*Future, error) {
+	asyncCommander.mutex.RLock()
+	defer asyncCommander.mutex.RUnlock()
+
+	if asyncCommander.isClosing() {
+		return nil, ErrAsyncCommanderClosed
+	}
+
+	job := newAsyncJob(ctx, command)
+
+	select {
+	case asyncCommander.queue <- job:
+		return job.future, nil
+	default:
+		return nil, ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting new commands and waits for the queued and in-flight commands to finish.
+// If ctx is done before that, Shutdown returns ctx.Err() and the remaining commands keep running
+// in the background.
+func (asyncCommander *AsyncCommander) Shutdown(ctx context.Context) error {
+	asyncCommander.shutdownOnce.Do(func() {
+		close(asyncCommander.closing)
+
+		// wait for the submissions in progress to give up or finish queueing before closing the queue
+		asyncCommander.mutex.Lock()
+		close(asyncCommander.queue)
+		asyncCommander.mutex.Unlock()
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		asyncCommander.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (asyncCommander *AsyncCommander) isClosing() bool {
+	select {
+	case <-asyncCommander.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+func (asyncCommander *AsyncCommander) work() {
+	defer asyncCommander.workers.Done()
+
+	for job := range asyncCommander.queue {
+		asyncCommander.run(job)
+	}
+}
+
+func (asyncCommander *AsyncCommander) run(job *asyncJob) {
+	var (
+		result any
+		err    error
+	)
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			errorId, _ := shortid.Generate()
+			log.FromContext(job.ctx).Errorw("unexpected panic occurred while handling async command",
+				"command", job.command.Key(),
+				"error", recovered,
+				"errorId", errorId,
+				"stacktrace", string(debug.Stack()))
+
+			result = nil
+			err = &PanicError{Key: job.command.Key(), ErrorId: errorId, Value: recovered}
+		}
+
+		job.future.resolve(result, err)
+	}()
+
+	result, err = asyncCommander.executor.Execute(job.ctx, job.command)
+	if err != nil {
+		log.FromContext(job.ctx).Warnw(fmt.Sprintf("Async command %s failed", job.command.Key()), "error", err)
+	}
+}
+
+func newAsyncJob(ctx context.Context, command Command) *asyncJob {
+	return &asyncJob{
+		ctx:     detachContext(ctx),
+		command: command,
+		future:  &Future{done: make(chan struct{})},
+	}
+}
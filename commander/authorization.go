@@ -0,0 +1,183 @@
+package commander
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/jwtverifier"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+const (
+	// ScopeClaim is the claim that holds the scopes granted to the caller.
+	ScopeClaim = "scope"
+
+	// RolesClaim is the claim that holds the roles granted to the caller.
+	RolesClaim = "roles"
+
+	// SubjectClaim is the claim that identifies the caller.
+	SubjectClaim = "sub"
+
+	// TenantClaim is the claim that holds the tenant of the caller's client.
+	TenantClaim = "client_tenant_id"
+)
+
+// ScopedCommand can be implemented by a Command to require the caller to have at least one of the scopes.
+type ScopedCommand interface {
+	RequiredScopes() []string
+}
+
+// RoleCommand can be implemented by a Command to require the caller to have at least one of the roles.
+type RoleCommand interface {
+	RequiredRoles() []string
+}
+
+// ServiceIdentity is the identity that commands dispatched by the service itself, e.g. from a consumer
+// or a scheduler, are authorized with when there are no claims in the context.
+type ServiceIdentity struct {
+	Name   string
+	Scopes []string
+	Roles  []string
+}
+
+type serviceIdentityContextKey int
+
+const (
+	serviceIdentityKey serviceIdentityContextKey = iota
+)
+
+// NewServiceIdentityContext creates a new context enriched with the service identity.
+func NewServiceIdentityContext(ctx context.Context, identity ServiceIdentity) context.Context {
+	return context.WithValue(ctx, serviceIdentityKey, identity)
+}
+
+// ServiceIdentityFromContext returns the service identity from the given context.
+func ServiceIdentityFromContext(ctx context.Context) (ServiceIdentity, bool) {
+	identity, ok := ctx.Value(serviceIdentityKey).(ServiceIdentity)
+
+	return identity, ok
+}
+
+// WithoutIdentity returns a copy of the context without the claims and the service identity of the caller, so
+// that commands executed with it are authorized as an unidentified caller, e.g. for commands received from
+// a transport that can't identify their sender.
+func WithoutIdentity(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, serviceIdentityKey, nil)
+
+	return jwtverifier.NewContext(ctx, nil)
+}
+
+// ForbiddenError is returned by the AuthorizationBehavior when the caller is not allowed to execute
+// a command. It implements render.Renderer so that it can be rendered as a 403 response payload.
+type ForbiddenError struct {
+	Key      string   `json:"-"`
+	Message  string   `json:"message"`
+	Required []string `json:"required,omitempty"`
+}
+
+func (e *ForbiddenError) Error() string {
+	if len(e.Required) == 0 {
+		return fmt.Sprintf("forbidden to execute command %s: %s", e.Key, e.Message)
+	}
+
+	return fmt.Sprintf("forbidden to execute command %s: %s (requires one of %s)", e.Key, e.Message, strings.Join(e.Required, ", "))
+}
+
+// Render sets the response status to 403 Forbidden.
+func (e *ForbiddenError) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusForbidden)
+
+	return nil
+}
+
+// AuthorizationBehavior checks that the caller has at least one of the scopes of a ScopedCommand and one
+// of the roles of a RoleCommand before the command is handled. The caller is identified by the claims
+// from jwtverifier.ClaimsFromContext or, if there are none, by the ServiceIdentity in the context.
+// A *ForbiddenError is returned if the caller is not allowed, regardless of which transport
+// dispatched the command. Commands that implement neither interface are not checked.
+func AuthorizationBehavior() Behavior {
+	return func(next Handler) Handler {
+		fn := func(ctx context.Context, command Command) (any, error) {
+			requiredScopes := []string{}
+			if scoped, ok := command.(ScopedCommand); ok {
+				requiredScopes = scoped.RequiredScopes()
+			}
+
+			requiredRoles := []string{}
+			if roled, ok := command.(RoleCommand); ok {
+				requiredRoles = roled.RequiredRoles()
+			}
+
+			if len(requiredScopes) == 0 && len(requiredRoles) == 0 {
+				return next.HandleIt(ctx, command)
+			}
+
+			scopes, roles, ok := grantsFromContext(ctx)
+			if !ok {
+				log.FromContext(ctx).Warnw("Could not get claims or service identity from context", "command", command.Key())
+
+				return nil, &ForbiddenError{Key: command.Key(), Message: "the caller could not be identified"}
+			}
+
+			if len(requiredScopes) > 0 && !containsAny(scopes, requiredScopes) {
+				return nil, &ForbiddenError{Key: command.Key(), Message: "missing scope", Required: requiredScopes}
+			}
+
+			if len(requiredRoles) > 0 && !containsAny(roles, requiredRoles) {
+				return nil, &ForbiddenError{Key: command.Key(), Message: "missing role", Required: requiredRoles}
+			}
+
+			return next.HandleIt(ctx, command)
+		}
+		return HandlerFunc(fn)
+	}
+}
+
+// grantsFromContext returns the scopes and roles of the caller from the claims or the service identity.
+func grantsFromContext(ctx context.Context) (scopes []string, roles []string, ok bool) {
+	if claims := jwtverifier.ClaimsFromContext(ctx); claims != nil {
+		return claimValues(claims[ScopeClaim]), claimValues(claims[RolesClaim]), true
+	}
+
+	if identity, ok := ServiceIdentityFromContext(ctx); ok {
+		return identity.Scopes, identity.Roles, true
+	}
+
+	return nil, nil, false
+}
+
+// claimValues reads a claim that is either a list of strings or a single space separated string.
+func claimValues(claim any) []string {
+	switch values := claim.(type) {
+	case []string:
+		return values
+	case []any:
+		strs := make([]string, 0, len(values))
+		for _, value := range values {
+			if str, ok := value.(string); ok {
+				strs = append(strs, str)
+			}
+		}
+
+		return strs
+	case string:
+		return strings.Fields(values)
+	default:
+		return nil
+	}
+}
+
+func containsAny(values []string, searchValues []string) bool {
+	for _, value := range values {
+		for _, searchValue := range searchValues {
+			if value == searchValue {
+				return true
+			}
+		}
+	}
+
+	return false
+}
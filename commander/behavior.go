@@ -0,0 +1,132 @@
+package commander
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/teris-io/shortid"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/correlation"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+// Behavior wraps a Handler with cross-cutting logic such as logging, timing, panic recovery, validation,
+// timeouts or transactions. It is the commander equivalent of httpmiddleware.MiddlewareFunc and is
+// registered with Commander.WithBehaviors.
+type Behavior func(next Handler) Handler
+
+// chain wraps the handler with the behaviors so that behaviors[0] is the outermost one.
+func chain(handler Handler, behaviors []Behavior) Handler {
+	for i := len(behaviors) - 1; i >= 0; i-- {
+		handler = behaviors[i](handler)
+	}
+
+	return handler
+}
+
+// TimeoutCommand can be implemented by a Command to override the timeout of the TimeoutBehavior.
+type TimeoutCommand interface {
+	Timeout() time.Duration
+}
+
+// PanicError is returned by the PanicRecoveryBehavior when a handler panics.
+// The ErrorId is also written to the logs so that it can be returned to the client and looked up later.
+type PanicError struct {
+	Key     string
+	ErrorId string
+	Value   any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("unexpected panic while handling command %s (errorId %s): %v", e.Key, e.ErrorId, e.Value)
+}
+
+// LoggerBehavior logs the start and end of each command along with how long it took and
+// the error, if any. The logger is taken from the context with log.FromContext and is tagged with
+// the command key and the correlation id from correlation.FromContext. The tagged logger and
+// correlation id are saved in the context passed on to the next handler.
+func LoggerBehavior() Behavior {
+	return func(next Handler) Handler {
+		fn := func(ctx context.Context, command Command) (any, error) {
+			correlationId := correlation.FromContext(ctx)
+
+			logger := log.FromContext(ctx).With(
+				"correlation-id", correlationId,
+				"command", command.Key(),
+			)
+
+			ctx = correlation.NewContext(ctx, correlationId)
+			ctx = log.NewContext(ctx, logger)
+
+			logger.Infof("Begin command %s", command.Key())
+
+			t1 := time.Now()
+			result, err := next.HandleIt(ctx, command)
+
+			if err != nil {
+				logger.Warnw(fmt.Sprintf("End command %s with error", command.Key()),
+					"error", err,
+					"duration", time.Since(t1))
+			} else {
+				logger.Infow(fmt.Sprintf("End command %s", command.Key()),
+					"duration", time.Since(t1))
+			}
+
+			return result, err
+		}
+		return HandlerFunc(fn)
+	}
+}
+
+// PanicRecoveryBehavior recovers from unexpected panics in the handler and logs it as an error.
+// The panic is returned to the caller as a *PanicError. Place it after the LoggerBehavior so that
+// the panic is logged with the tagged logger.
+func PanicRecoveryBehavior() Behavior {
+	return func(next Handler) Handler {
+		fn := func(ctx context.Context, command Command) (result any, err error) {
+			defer func() {
+				recovered := recover()
+
+				if recovered != nil {
+					errorId, _ := shortid.Generate()
+					log.FromContext(ctx).Errorw("unexpected panic occurred while handling command",
+						"command", command.Key(),
+						"error", recovered,
+						"errorId", errorId,
+						"stacktrace", string(debug.Stack()))
+
+					result = nil
+					err = &PanicError{Key: command.Key(), ErrorId: errorId, Value: recovered}
+				}
+			}()
+
+			return next.HandleIt(ctx, command)
+		}
+		return HandlerFunc(fn)
+	}
+}
+
+// TimeoutBehavior cancels the context passed to the handler after the given timeout.
+// Commands that implement TimeoutCommand use their own timeout instead. A timeout of zero or less
+// disables the behavior for that command. The handler is responsible for honoring the context.
+func TimeoutBehavior(timeout time.Duration) Behavior {
+	return func(next Handler) Handler {
+		fn := func(ctx context.Context, command Command) (any, error) {
+			commandTimeout := timeout
+			if timeoutCommand, ok := command.(TimeoutCommand); ok {
+				commandTimeout = timeoutCommand.Timeout()
+			}
+
+			if commandTimeout <= 0 {
+				return next.HandleIt(ctx, command)
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+			defer cancel()
+
+			return next.HandleIt(ctx, command)
+		}
+		return HandlerFunc(fn)
+	}
+}
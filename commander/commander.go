@@ -3,12 +3,21 @@ package commander
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
 )
 
+// Commander dispatches commands to the handler registered for their key. A Commander is immutable:
+// WithHandler and WithBehaviors return modified copies, so a Commander is safe for concurrent use.
 type Commander struct {
-	handlers map[string]Handler
+	registry  *Registry
+	behaviors []Behavior
+}
+
+// NewCommander creates a Commander that dispatches to the handlers in the given Registry.
+func NewCommander(registry *Registry) Commander {
+	return Commander{registry: registry}
 }
 
 type Handler interface {
@@ -19,22 +28,87 @@ type Command interface {
 	Key() string
 }
 
+// HandlerFunc is an adapter to allow the use of ordinary functions as a Handler.
+type HandlerFunc func(ctx context.Context, command Command) (any, error)
+
+// HandleIt calls f(ctx, command).
+func (f HandlerFunc) HandleIt(ctx context.Context, command Command) (any, error) {
+	return f(ctx, command)
+}
+
+// WithHandler returns a copy of the Commander with the handler registered for the key of zeroCommand.
+// An existing handler for the same key is silently replaced.
+//
+// Deprecated: Use a RegistryBuilder and NewCommander, or Register, which report duplicate keys
+// as a *DuplicateHandlerError.
 func (commander Commander) WithHandler(handler Handler, zeroCommand Command) Commander {
-	if commander.handlers == nil {
-		commander.handlers = make(map[string]Handler)
-	}
+	commander.registry = commander.registry.with(zeroCommand.Key(), handler)
 
-	commander.handlers[zeroCommand.Key()] = handler
+	return commander
+}
+
+// WithBehaviors returns a copy of the Commander that wraps every handler invocation with the given behaviors.
+// Behaviors are applied in the order given, so the first behavior is the outermost one and sees the
+// command first and the result last.
+func (commander Commander) WithBehaviors(behaviors ...Behavior) Commander {
+	combined := make([]Behavior, 0, len(commander.behaviors)+len(behaviors))
+	combined = append(combined, commander.behaviors...)
+	combined = append(combined, behaviors...)
+
+	commander.behaviors = combined
 
 	return commander
 }
 
+// Has returns true if a handler is registered for the given command key.
+func (commander Commander) Has(key string) bool {
+	return commander.registry.Has(key)
+}
+
+// Handlers returns the sorted keys of all the commands that have a handler.
+func (commander Commander) Handlers() []string {
+	return commander.registry.Handlers()
+}
+
+// HandlerNotFoundError is returned by the Commander when no handler is registered for the command key.
+type HandlerNotFoundError struct {
+	Key string
+}
+
+func (e *HandlerNotFoundError) Error() string {
+	return fmt.Sprintf("Commander encountered a command for which no handler was configured: %s", e.Key)
+}
+
+// Execute dispatches the command to its handler through the configured behaviors.
+// If the command is a ValidatableCommand, it is validated after the behaviors, right before the
+// handler, and a *ValidationError is returned without invoking the handler if it is invalid. The domain events raised by the handler
+// with RaiseEvent are published once it has returned successfully, see EventCollector.
+//
+// Each execution is traced with a span named after the command key and counted in the commands.executed
+// and commands.duration metrics, labeled by key and outcome. A command whose handler panics is recorded as
+// an error before the panic is propagated.
 func (commander Commander) Execute(ctx context.Context, command Command) (any, error) {
-	if handler, ok := commander.handlers[command.Key()]; ok {
-		return handler.HandleIt(ctx, command)
+	start := time.Now()
+
+	ctx, span := startCommandSpan(ctx, command)
+
+	err := errCommandPanicked
+	defer func() {
+		recordCommand(ctx, span, command, start, err)
+	}()
+
+	var result any
+	result, err = commander.execute(ctx, command)
+
+	return result, err
+}
+
+func (commander Commander) execute(ctx context.Context, command Command) (any, error) {
+	if handler, ok := commander.registry.Handler(command.Key()); ok {
+		return handleWithEvents(ctx, chain(validationBehavior()(handler), commander.behaviors), command)
 	}
 
-	err := fmt.Errorf("Commander encountered a command for which no handler was configured: %s", command.Key())
+	err := &HandlerNotFoundError{Key: command.Key()}
 
 	logger := log.FromContext(ctx)
 	logger.Error(err)
@@ -0,0 +1,897 @@
+package commander
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/auditeventspublisher"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/correlation"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/jwtverifier"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetrics "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type createTenant struct {
+	Name string
+}
+
+func (c *createTenant) Key() string {
+	return "CreateTenant"
+}
+
+type tenant struct {
+	Id   string
+	Name string
+}
+
+type deleteTenant struct {
+	Id string
+}
+
+func (c deleteTenant) Key() string {
+	return "DeleteTenant"
+}
+
+func TestTypedCommander(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	createHandler := TypedHandlerFunc[*createTenant, *tenant](func(ctx context.Context, command *createTenant) (*tenant, error) {
+		return &tenant{Id: "t-1", Name: command.Name}, nil
+	})
+
+	deleteHandler := TypedHandlerFunc[deleteTenant, bool](func(ctx context.Context, command deleteTenant) (bool, error) {
+		if command.Id == "" {
+			return false, errors.New("id is required")
+		}
+
+		return true, nil
+	})
+
+	cmdr, err := Register[*createTenant, *tenant](Commander{}, createHandler)
+	require.NoError(t, err)
+
+	cmdr, err = Register[deleteTenant, bool](cmdr, deleteHandler)
+	require.NoError(t, err)
+
+	t.Run("should return a typed result", func(t *testing.T) {
+		result, err := Send[*tenant](context.Background(), cmdr, &createTenant{Name: "acme"})
+
+		require.NoError(t, err)
+		assert.Equal(t, &tenant{Id: "t-1", Name: "acme"}, result)
+	})
+
+	t.Run("should support value commands", func(t *testing.T) {
+		deleted, err := Send[bool](context.Background(), cmdr, deleteTenant{Id: "t-1"})
+
+		require.NoError(t, err)
+		assert.True(t, deleted)
+	})
+
+	t.Run("should report a duplicate registration", func(t *testing.T) {
+		_, err := Register[*createTenant, *tenant](cmdr, createHandler)
+
+		var duplicate *DuplicateHandlerError
+		require.ErrorAs(t, err, &duplicate)
+		assert.Equal(t, (&createTenant{}).Key(), duplicate.Key)
+	})
+
+	t.Run("should return the handler error", func(t *testing.T) {
+		deleted, err := Send[bool](context.Background(), cmdr, deleteTenant{})
+
+		assert.EqualError(t, err, "id is required")
+		assert.False(t, deleted)
+	})
+
+	t.Run("should fail when the result type does not match", func(t *testing.T) {
+		_, err := Send[string](context.Background(), cmdr, &createTenant{Name: "acme"})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should keep the untyped Execute working", func(t *testing.T) {
+		var executor Executor = cmdr
+
+		result, err := executor.Execute(context.Background(), &createTenant{Name: "acme"})
+
+		require.NoError(t, err)
+		assert.Equal(t, "acme", result.(*tenant).Name)
+	})
+}
+
+func TestBehaviors(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	t.Run("should run behaviors in order around the handler", func(t *testing.T) {
+		var calls []string
+
+		record := func(name string) Behavior {
+			return func(next Handler) Handler {
+				return HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+					calls = append(calls, "before "+name)
+					result, err := next.HandleIt(ctx, command)
+					calls = append(calls, "after "+name)
+
+					return result, err
+				})
+			}
+		}
+
+		handler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+			calls = append(calls, "handler")
+			return nil, nil
+		})
+
+		cmdr := Commander{}.
+			WithHandler(handler, &createTenant{}).
+			WithBehaviors(LoggerBehavior(), record("first")).
+			WithBehaviors(record("second"))
+
+		_, err := cmdr.Execute(context.Background(), &createTenant{})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"before first", "before second", "handler", "after second", "after first"}, calls)
+	})
+
+	t.Run("should recover from panics", func(t *testing.T) {
+		handler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+			panic("boom")
+		})
+
+		cmdr := Commander{}.
+			WithHandler(handler, &createTenant{}).
+			WithBehaviors(PanicRecoveryBehavior())
+
+		_, err := cmdr.Execute(context.Background(), &createTenant{})
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, "boom", panicErr.Value)
+		assert.NotEmpty(t, panicErr.ErrorId)
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	handler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+		return "created", nil
+	})
+
+	t.Run("should reject duplicate keys", func(t *testing.T) {
+		builder := NewRegistryBuilder()
+
+		require.NoError(t, builder.Add(handler, &createTenant{}))
+		err := builder.Add(handler, &createTenant{})
+
+		var duplicateErr *DuplicateHandlerError
+		require.ErrorAs(t, err, &duplicateErr)
+		assert.Equal(t, "CreateTenant", duplicateErr.Key)
+	})
+
+	t.Run("should not see handlers added after Build", func(t *testing.T) {
+		builder := NewRegistryBuilder()
+		require.NoError(t, builder.Add(handler, &createTenant{}))
+
+		registry := builder.Build()
+		require.NoError(t, builder.Add(handler, deleteTenant{}))
+
+		assert.Equal(t, []string{"CreateTenant"}, registry.Handlers())
+		assert.True(t, registry.Has("CreateTenant"))
+		assert.False(t, registry.Has("DeleteTenant"))
+		assert.EqualError(t, registry.Require("CreateTenant", "DeleteTenant"), "no handler was configured for the commands: DeleteTenant")
+	})
+
+	t.Run("should not share handlers between copies of a Commander", func(t *testing.T) {
+		base := Commander{}.WithHandler(handler, &createTenant{})
+		extended := base.WithHandler(handler, deleteTenant{})
+
+		assert.Equal(t, []string{"CreateTenant"}, base.Handlers())
+		assert.Equal(t, []string{"CreateTenant", "DeleteTenant"}, extended.Handlers())
+	})
+
+	t.Run("should dispatch to the registry handlers", func(t *testing.T) {
+		builder := NewRegistryBuilder()
+		require.NoError(t, AddTyped[*createTenant, *tenant](builder, TypedHandlerFunc[*createTenant, *tenant](
+			func(ctx context.Context, command *createTenant) (*tenant, error) {
+				return &tenant{Name: command.Name}, nil
+			})))
+
+		cmdr := NewCommander(builder.Build())
+
+		result, err := Send[*tenant](context.Background(), cmdr, &createTenant{Name: "acme"})
+
+		require.NoError(t, err)
+		assert.Equal(t, "acme", result.Name)
+	})
+}
+
+func TestAsyncCommander(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	t.Run("should execute the command with the caller's correlation id", func(t *testing.T) {
+		handler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+			return correlation.FromContext(ctx), nil
+		})
+
+		asyncCommander := NewAsyncCommander(Commander{}.WithHandler(handler, &createTenant{}), 2, 10)
+
+		ctx, cancel := context.WithCancel(correlation.NewContext(context.Background(), "cid-1"))
+		future, err := asyncCommander.Submit(ctx, &createTenant{})
+		require.NoError(t, err)
+
+		// the command must not be cancelled along with the caller
+		cancel()
+
+		result, err := future.Wait(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, "cid-1", result)
+		require.NoError(t, asyncCommander.Shutdown(context.Background()))
+	})
+
+	t.Run("should apply backpressure and drain on shutdown", func(t *testing.T) {
+		release := make(chan struct{})
+		handler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+			<-release
+			return "done", nil
+		})
+
+		asyncCommander := NewAsyncCommander(Commander{}.WithHandler(handler, &createTenant{}), 1, 1)
+
+		running, err := asyncCommander.Submit(context.Background(), &createTenant{})
+		require.NoError(t, err)
+
+		var queued *Future
+		require.Eventually(t, func() bool {
+			queued, err = asyncCommander.TrySubmit(context.Background(), &createTenant{})
+			return err == nil
+		}, time.Second, time.Millisecond)
+
+		_, err = asyncCommander.TrySubmit(context.Background(), &createTenant{})
+		assert.ErrorIs(t, err, ErrQueueFull)
+
+		shutdownErr := make(chan error)
+		go func() {
+			shutdownErr <- asyncCommander.Shutdown(context.Background())
+		}()
+
+		require.Eventually(t, func() bool {
+			_, err := asyncCommander.TrySubmit(context.Background(), &createTenant{})
+			return errors.Is(err, ErrAsyncCommanderClosed)
+		}, time.Second, time.Millisecond)
+
+		close(release)
+
+		require.NoError(t, <-shutdownErr)
+
+		for _, future := range []*Future{running, queued} {
+			result, err := future.Wait(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "done", result)
+		}
+	})
+}
+
+type inviteUser struct {
+	Email string
+}
+
+func (c *inviteUser) Key() string {
+	return "InviteUser"
+}
+
+func (c *inviteUser) RequiredScopes() []string {
+	return []string{"id.users:write"}
+}
+
+func (c *inviteUser) Validate() error {
+	var errs []error
+
+	if c.Email == "" {
+		errs = append(errs, NewFieldError("email", "is required"))
+	}
+
+	if c.Email == "panic" {
+		panic("could not validate email")
+	}
+
+	return errors.Join(errs...)
+}
+
+func TestValidation(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	called := false
+	handler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+		called = true
+		return nil, nil
+	})
+
+	cmdr := Commander{}.
+		WithHandler(handler, &inviteUser{}).
+		WithBehaviors(PanicRecoveryBehavior(), AuthorizationBehavior())
+
+	ctx := jwtverifier.NewContext(context.Background(), map[string]any{"scope": "id.users:write"})
+
+	t.Run("should not invoke the handler when validation fails", func(t *testing.T) {
+		_, err := cmdr.Execute(ctx, &inviteUser{})
+
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "InviteUser", validationErr.Key)
+		assert.Equal(t, []FieldError{{Field: "email", Message: "is required"}}, validationErr.Errors)
+		assert.False(t, called)
+	})
+
+	t.Run("should invoke the handler when validation passes", func(t *testing.T) {
+		_, err := cmdr.Execute(ctx, &inviteUser{Email: "jane@acme.com"})
+
+		require.NoError(t, err)
+		assert.True(t, called)
+	})
+
+	t.Run("should authorize the command before validating it", func(t *testing.T) {
+		_, err := cmdr.Execute(context.Background(), &inviteUser{})
+
+		var forbiddenErr *ForbiddenError
+		require.ErrorAs(t, err, &forbiddenErr)
+	})
+
+	t.Run("should recover from panics in Validate", func(t *testing.T) {
+		_, err := cmdr.Execute(ctx, &inviteUser{Email: "panic"})
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, "InviteUser", panicErr.Key)
+	})
+}
+
+type recordingPublisher struct {
+	events []any
+	fail   func(event any) bool
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event any) error {
+	if p.fail != nil && p.fail(event) {
+		return errors.New("broker unavailable")
+	}
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+type tenantCreated struct {
+	Name string
+}
+
+type tenantAuditCreated struct {
+	Name string
+}
+
+func TestDomainEvents(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	var cmdr Commander
+
+	createHandler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+		create := command.(*createTenant)
+		RaiseEvent(ctx, tenantCreated{Name: create.Name})
+
+		if create.Name == "fail" {
+			return nil, errors.New("could not create tenant")
+		}
+
+		return cmdr.Execute(ctx, deleteTenant{Id: create.Name})
+	})
+
+	deleteHandler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+		RaiseEvent(ctx, tenantAuditCreated{Name: command.(deleteTenant).Id})
+		return "ok", nil
+	})
+
+	cmdr = Commander{}.
+		WithHandler(createHandler, &createTenant{}).
+		WithHandler(deleteHandler, deleteTenant{})
+
+	t.Run("should publish the events in order after the command succeeds", func(t *testing.T) {
+		publisher := &recordingPublisher{}
+		ctx := auditeventspublisher.NewContext(context.Background(), publisher)
+
+		_, err := cmdr.Execute(ctx, &createTenant{Name: "acme"})
+
+		require.NoError(t, err)
+		assert.Equal(t, []any{tenantCreated{Name: "acme"}, tenantAuditCreated{Name: "acme"}}, publisher.events)
+	})
+
+	t.Run("should discard the events when the command fails", func(t *testing.T) {
+		publisher := &recordingPublisher{}
+		ctx := auditeventspublisher.NewContext(context.Background(), publisher)
+
+		_, err := cmdr.Execute(ctx, &createTenant{Name: "fail"})
+
+		require.Error(t, err)
+		assert.Empty(t, publisher.events)
+	})
+
+	t.Run("should return the result and publish the other events when publishing an event fails", func(t *testing.T) {
+		publisher := &recordingPublisher{fail: func(event any) bool {
+			_, ok := event.(tenantCreated)
+			return ok
+		}}
+		ctx := auditeventspublisher.NewContext(context.Background(), publisher)
+
+		result, err := cmdr.Execute(ctx, &createTenant{Name: "acme"})
+
+		require.NoError(t, err)
+		assert.Equal(t, "ok", result)
+		assert.Equal(t, []any{tenantAuditCreated{Name: "acme"}}, publisher.events)
+	})
+}
+
+type getTenant struct {
+	Id string
+}
+
+func (q *getTenant) Key() string {
+	return "GetTenant"
+}
+
+func (q *getTenant) CacheKey() string {
+	return q.Id
+}
+
+func (q *getTenant) CacheTTL() time.Duration {
+	return time.Minute
+}
+
+type renameTenant struct {
+	Id string
+}
+
+func (c *renameTenant) Key() string {
+	return "RenameTenant"
+}
+
+func (c *renameTenant) InvalidatesQueries() []string {
+	return []string{"GetTenant"}
+}
+
+func TestQueryBus(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	calls := 0
+	queryHandler := QueryHandlerFunc(func(ctx context.Context, query Query) (any, error) {
+		calls++
+		return &tenant{Id: query.(*getTenant).Id}, nil
+	})
+
+	builder := NewQueryBusBuilder()
+	require.NoError(t, builder.Add(queryHandler, &getTenant{}))
+	bus := builder.Build()
+
+	renameHandler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+		return nil, nil
+	})
+
+	deleteHandler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+		InvalidateQuery(ctx, "GetTenant", command.(deleteTenant).Id)
+		return nil, nil
+	})
+
+	cmdr := Commander{}.
+		WithHandler(renameHandler, &renameTenant{}).
+		WithHandler(deleteHandler, deleteTenant{}).
+		WithBehaviors(InvalidationBehavior(bus))
+
+	t.Run("should cache results per cache key", func(t *testing.T) {
+		calls = 0
+
+		first, err := Ask[*tenant](context.Background(), bus, &getTenant{Id: "t-1"})
+		require.NoError(t, err)
+		second, err := Ask[*tenant](context.Background(), bus, &getTenant{Id: "t-1"})
+		require.NoError(t, err)
+		_, err = Ask[*tenant](context.Background(), bus, &getTenant{Id: "t-2"})
+		require.NoError(t, err)
+
+		assert.Same(t, first, second)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("should fail when the result is not of the expected type", func(t *testing.T) {
+		_, err := Ask[string](context.Background(), bus, &getTenant{Id: "t-1"})
+
+		assert.EqualError(t, err, "query GetTenant returned a result of type *commander.tenant but string was expected")
+	})
+
+	t.Run("should invalidate the queries declared by the command", func(t *testing.T) {
+		bus.Invalidate("GetTenant")
+		calls = 0
+
+		_, err := bus.Ask(context.Background(), &getTenant{Id: "t-1"})
+		require.NoError(t, err)
+		_, err = cmdr.Execute(context.Background(), &renameTenant{Id: "t-1"})
+		require.NoError(t, err)
+		_, err = bus.Ask(context.Background(), &getTenant{Id: "t-1"})
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("should invalidate the queries requested by the handler", func(t *testing.T) {
+		_, err := bus.Ask(context.Background(), &getTenant{Id: "t-1"})
+		require.NoError(t, err)
+		_, err = bus.Ask(context.Background(), &getTenant{Id: "t-2"})
+		require.NoError(t, err)
+		calls = 0
+
+		_, err = cmdr.Execute(context.Background(), deleteTenant{Id: "t-1"})
+		require.NoError(t, err)
+		_, err = bus.Ask(context.Background(), &getTenant{Id: "t-1"})
+		require.NoError(t, err)
+		_, err = bus.Ask(context.Background(), &getTenant{Id: "t-2"})
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should not cache a result when the query is invalidated while it is handled", func(t *testing.T) {
+		var calls atomic.Int32
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		builder := NewQueryBusBuilder()
+		require.NoError(t, builder.Add(QueryHandlerFunc(func(ctx context.Context, query Query) (any, error) {
+			if calls.Add(1) == 1 {
+				close(started)
+				<-release
+			}
+
+			return &tenant{Id: query.(*getTenant).Id}, nil
+		}), &getTenant{}))
+		bus := builder.Build()
+
+		done := make(chan error)
+		go func() {
+			_, err := bus.Ask(context.Background(), &getTenant{Id: "t-1"})
+			done <- err
+		}()
+
+		<-started
+		bus.Invalidate("GetTenant", "t-1")
+		close(release)
+		require.NoError(t, <-done)
+
+		_, err := bus.Ask(context.Background(), &getTenant{Id: "t-1"})
+		require.NoError(t, err)
+		_, err = bus.Ask(context.Background(), &getTenant{Id: "t-1"})
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+}
+
+type provisionIdp struct {
+	RequestId string
+}
+
+func (c *provisionIdp) Key() string {
+	return "ProvisionIdp"
+}
+
+func (c *provisionIdp) IdempotencyKey() string {
+	return c.RequestId
+}
+
+type idp struct {
+	Id     string
+	Issuer string
+}
+
+type registerIdp struct {
+	RequestId string
+}
+
+func (c *registerIdp) Key() string {
+	return "RegisterIdp"
+}
+
+func (c *registerIdp) IdempotencyKey() string {
+	return c.RequestId
+}
+
+func (c *registerIdp) NewIdempotencyResult() any {
+	return new(*idp)
+}
+
+// signallingIdempotencyStore signals each call to Acquire before it is forwarded to the store.
+type signallingIdempotencyStore struct {
+	*InMemoryIdempotencyStore
+	acquiring chan string
+}
+
+func (store *signallingIdempotencyStore) Acquire(ctx context.Context, key string) (*IdempotencyRecord, bool, error) {
+	store.acquiring <- key
+
+	return store.InMemoryIdempotencyStore.Acquire(ctx, key)
+}
+
+func TestIdempotency(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	var calls atomic.Int32
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	handler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+		calls.Add(1)
+		started <- struct{}{}
+
+		<-release
+		return "provisioned", nil
+	})
+
+	store := &signallingIdempotencyStore{InMemoryIdempotencyStore: NewInMemoryIdempotencyStore(), acquiring: make(chan string, 3)}
+	cmdr := Commander{}.
+		WithHandler(handler, &provisionIdp{}).
+		WithBehaviors(IdempotencyBehavior(store, time.Minute))
+
+	t.Run("should make concurrent duplicates wait for the first execution", func(t *testing.T) {
+		execute := func(results chan<- any) {
+			result, err := cmdr.Execute(context.Background(), &provisionIdp{RequestId: "r-1"})
+			assert.NoError(t, err)
+			results <- result
+		}
+
+		first := make(chan any, 1)
+		go execute(first)
+		<-store.acquiring
+		<-started
+
+		duplicates := make(chan any, 2)
+		for i := 0; i < 2; i++ {
+			go execute(duplicates)
+		}
+
+		<-store.acquiring
+		<-store.acquiring
+		assert.Empty(t, duplicates, "duplicates returned while the first execution was running")
+
+		close(release)
+
+		assert.Equal(t, "provisioned", <-first)
+		assert.Equal(t, "provisioned", <-duplicates)
+		assert.Equal(t, "provisioned", <-duplicates)
+		assert.Equal(t, int32(1), calls.Load())
+
+		result, err := cmdr.Execute(context.Background(), &provisionIdp{RequestId: "r-1"})
+		<-store.acquiring
+		require.NoError(t, err)
+		assert.Equal(t, "provisioned", result)
+		assert.Equal(t, int32(1), calls.Load())
+
+		_, err = cmdr.Execute(context.Background(), &provisionIdp{RequestId: "r-2"})
+		<-store.acquiring
+		<-started
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("should not share results between callers", func(t *testing.T) {
+		var calls int
+		cmdr := Commander{}.
+			WithHandler(HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+				calls++
+				return calls, nil
+			}), &provisionIdp{}).
+			WithBehaviors(IdempotencyBehavior(NewInMemoryIdempotencyStore(), time.Minute))
+
+		callers := []context.Context{
+			jwtverifier.NewContext(context.Background(), map[string]any{SubjectClaim: "alice", TenantClaim: "acme"}),
+			jwtverifier.NewContext(context.Background(), map[string]any{SubjectClaim: "bob", TenantClaim: "acme"}),
+			jwtverifier.NewContext(context.Background(), map[string]any{SubjectClaim: "alice", TenantClaim: "globex"}),
+			NewServiceIdentityContext(context.Background(), ServiceIdentity{Name: "scheduler"}),
+			context.Background(),
+		}
+
+		for _, ctx := range callers {
+			_, err := cmdr.Execute(ctx, &provisionIdp{RequestId: "r-1"})
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, len(callers), calls)
+
+		result, err := cmdr.Execute(callers[0], &provisionIdp{RequestId: "r-1"})
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), result)
+		assert.Equal(t, len(callers), calls)
+	})
+
+	t.Run("should store the result and error encoded", func(t *testing.T) {
+		var calls int
+		store := NewInMemoryIdempotencyStore()
+		cmdr := Commander{}.
+			WithHandler(HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+				calls++
+				switch command.(*registerIdp).RequestId {
+				case "r-fail":
+					return nil, NewValidationError(command.Key(), FieldError{Field: "issuer", Message: "is required"})
+				case "r-down":
+					return nil, errors.New("the identity provider is unavailable")
+				}
+
+				return &idp{Id: "idp-1", Issuer: "https://issuer"}, nil
+			}), &registerIdp{}).
+			WithBehaviors(IdempotencyBehavior(store, time.Minute))
+
+		for i := 0; i < 2; i++ {
+			result, err := Send[*idp](context.Background(), cmdr, &registerIdp{RequestId: "r-1"})
+			require.NoError(t, err)
+			assert.Equal(t, &idp{Id: "idp-1", Issuer: "https://issuer"}, result)
+		}
+
+		_, err := cmdr.Execute(context.Background(), &registerIdp{RequestId: "r-fail"})
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+
+		_, replayedErr := cmdr.Execute(context.Background(), &registerIdp{RequestId: "r-fail"})
+		require.ErrorAs(t, replayedErr, &validationErr)
+		assert.Equal(t, err, replayedErr)
+		assert.Equal(t, 2, calls)
+
+		w := httptest.NewRecorder()
+		require.NoError(t, render.Render(w, httptest.NewRequest(http.MethodPost, "/idps", nil), validationErr))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		for i := 0; i < 2; i++ {
+			_, err := cmdr.Execute(context.Background(), &registerIdp{RequestId: "r-down"})
+			assert.EqualError(t, err, "the identity provider is unavailable")
+		}
+		assert.Equal(t, 4, calls)
+
+		record, _, err := store.Acquire(context.Background(), `RegisterIdp:"":"":r-1`)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"Id":"idp-1","Issuer":"https://issuer"}`, string(record.Result))
+	})
+}
+
+type rotateSecret struct{}
+
+func (c rotateSecret) Key() string {
+	return "RotateSecret"
+}
+
+func (c rotateSecret) RequiredScopes() []string {
+	return []string{"id.secrets:write", "id.admin"}
+}
+
+func TestAuthorization(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	handler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+		return "rotated", nil
+	})
+
+	cmdr := Commander{}.
+		WithHandler(handler, rotateSecret{}).
+		WithBehaviors(AuthorizationBehavior())
+
+	t.Run("should allow callers with one of the scopes", func(t *testing.T) {
+		ctx := jwtverifier.NewContext(context.Background(), map[string]any{"scope": []any{"id.secrets:write"}})
+
+		result, err := cmdr.Execute(ctx, rotateSecret{})
+
+		require.NoError(t, err)
+		assert.Equal(t, "rotated", result)
+	})
+
+	t.Run("should forbid callers without the scopes", func(t *testing.T) {
+		ctx := jwtverifier.NewContext(context.Background(), map[string]any{"scope": []any{"id.secrets:read"}})
+
+		_, err := cmdr.Execute(ctx, rotateSecret{})
+
+		var forbiddenErr *ForbiddenError
+		require.ErrorAs(t, err, &forbiddenErr)
+		assert.Equal(t, []string{"id.secrets:write", "id.admin"}, forbiddenErr.Required)
+	})
+
+	t.Run("should authorize the service identity when there are no claims", func(t *testing.T) {
+		ctx := NewServiceIdentityContext(context.Background(), ServiceIdentity{Name: "scheduler", Scopes: []string{"id.admin"}})
+
+		_, err := cmdr.Execute(ctx, rotateSecret{})
+
+		require.NoError(t, err)
+	})
+
+	t.Run("should forbid unidentified callers", func(t *testing.T) {
+		_, err := cmdr.Execute(context.Background(), rotateSecret{})
+
+		var forbiddenErr *ForbiddenError
+		require.ErrorAs(t, err, &forbiddenErr)
+	})
+
+	t.Run("should forbid callers whose identity was removed", func(t *testing.T) {
+		ctx := NewServiceIdentityContext(context.Background(), ServiceIdentity{Name: "scheduler", Scopes: []string{"id.admin"}})
+		ctx = jwtverifier.NewContext(ctx, map[string]any{"scope": []any{"id.admin"}})
+
+		_, err := cmdr.Execute(WithoutIdentity(ctx), rotateSecret{})
+
+		var forbiddenErr *ForbiddenError
+		require.ErrorAs(t, err, &forbiddenErr)
+	})
+}
+
+func TestTelemetry(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	tracerProvider, meterProvider := otel.GetTracerProvider(), otel.GetMeterProvider()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(tracerProvider)
+		otel.SetMeterProvider(meterProvider)
+	})
+
+	spanRecorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+
+	metricReader := sdkmetrics.NewManualReader()
+	otel.SetMeterProvider(sdkmetrics.NewMeterProvider(sdkmetrics.WithReader(metricReader)))
+
+	handler := HandlerFunc(func(ctx context.Context, command Command) (any, error) {
+		return nil, nil
+	})
+
+	cmdr := Commander{}.WithHandler(handler, &inviteUser{})
+
+	_, err := cmdr.Execute(context.Background(), &inviteUser{Email: "jane@acme.com"})
+	require.NoError(t, err)
+	_, err = cmdr.Execute(context.Background(), &inviteUser{})
+	require.Error(t, err)
+	require.Panics(t, func() {
+		_, _ = cmdr.Execute(context.Background(), &inviteUser{Email: "panic"})
+	})
+
+	t.Run("should create a span per command", func(t *testing.T) {
+		spans := spanRecorder.Ended()
+
+		require.Len(t, spans, 3)
+		assert.Equal(t, "InviteUser", spans[0].Name())
+		assert.Equal(t, codes.Unset, spans[0].Status().Code)
+		assert.Equal(t, codes.Error, spans[1].Status().Code)
+		assert.Equal(t, codes.Error, spans[2].Status().Code)
+	})
+
+	t.Run("should count the commands by key and outcome", func(t *testing.T) {
+		var metrics metricdata.ResourceMetrics
+		require.NoError(t, metricReader.Collect(context.Background(), &metrics))
+
+		counts := map[string]int64{}
+		for _, scopeMetrics := range metrics.ScopeMetrics {
+			for _, m := range scopeMetrics.Metrics {
+				if m.Name != "commands.executed" {
+					continue
+				}
+
+				for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					key, _ := point.Attributes.Value(attribute.Key(CommandKeyAttribute))
+					outcome, _ := point.Attributes.Value(attribute.Key(CommandOutcomeAttribute))
+					counts[key.AsString()+"/"+outcome.AsString()] = point.Value
+				}
+			}
+		}
+
+		assert.Equal(t, map[string]int64{"InviteUser/success": 1, "InviteUser/invalid": 1, "InviteUser/error": 1}, counts)
+	})
+}
@@ -0,0 +1,217 @@
+// Package commandertest provides a programmable fake commander.Executor that records the commands
+// it receives, along with assertions on them, for testing code that sends commands.
+package commandertest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+)
+
+// Fake is a commander.Executor that returns canned results per command key and records every
+// command it receives. Commands without a canned result return nil, nil. It is safe for concurrent use.
+//
+// Example:
+//
+//	fake := commandertest.NewFake().Returns("CreateTenant", &Tenant{Id: "t-1"}, nil)
+//	// ... exercise the code under test with fake as its commander.Executor
+//	fake.AssertSentOnce(t, "CreateTenant", commandertest.Fields(map[string]any{"Name": "acme"}))
+type Fake struct {
+	mutex    sync.Mutex
+	handlers map[string]commander.Handler
+	received []commander.Command
+}
+
+var _ commander.Executor = &Fake{}
+
+// NewFake creates a Fake without canned results.
+func NewFake() *Fake {
+	return &Fake{
+		handlers: map[string]commander.Handler{},
+	}
+}
+
+// Returns makes the Fake return the result and error for every command with the given key.
+func (fake *Fake) Returns(key string, result any, err error) *Fake {
+	return fake.HandleFunc(key, func(ctx context.Context, command commander.Command) (any, error) {
+		return result, err
+	})
+}
+
+// HandleFunc makes the Fake invoke fn for every command with the given key, e.g. to compute the result
+// from the command.
+func (fake *Fake) HandleFunc(key string, fn commander.HandlerFunc) *Fake {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.handlers[key] = fn
+
+	return fake
+}
+
+// Execute records the command and returns the canned result for its key.
+func (fake *Fake) Execute(ctx context.Context, command commander.Command) (any, error) {
+	fake.mutex.Lock()
+	fake.received = append(fake.received, command)
+	handler, ok := fake.handlers[command.Key()]
+	fake.mutex.Unlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	return handler.HandleIt(ctx, command)
+}
+
+// Commands returns all the commands received so far, in order.
+func (fake *Fake) Commands() []commander.Command {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return append([]commander.Command{}, fake.received...)
+}
+
+// CommandsWithKey returns the commands with the given key received so far, in order.
+func (fake *Fake) CommandsWithKey(key string) []commander.Command {
+	var commands []commander.Command
+
+	for _, command := range fake.Commands() {
+		if command.Key() == key {
+			commands = append(commands, command)
+		}
+	}
+
+	return commands
+}
+
+// Reset forgets the commands received so far. The canned results are kept.
+func (fake *Fake) Reset() {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.received = nil
+}
+
+// AssertSent asserts that at least one command with the given key that satisfies all the matchers
+// was received.
+func (fake *Fake) AssertSent(t testing.TB, key string, matchers ...Matcher) bool {
+	t.Helper()
+
+	if len(fake.matching(key, matchers)) > 0 {
+		return true
+	}
+
+	t.Errorf("expected command %s to be sent%s but it wasn't\n%s", key, describeMatchers(matchers), fake.explain(key, matchers))
+
+	return false
+}
+
+// AssertSentOnce asserts that exactly one command with the given key that satisfies all the matchers
+// was received.
+func (fake *Fake) AssertSentOnce(t testing.TB, key string, matchers ...Matcher) bool {
+	t.Helper()
+
+	return fake.AssertSentTimes(t, key, 1, matchers...)
+}
+
+// AssertSentTimes asserts that exactly times commands with the given key that satisfy all the matchers
+// were received.
+func (fake *Fake) AssertSentTimes(t testing.TB, key string, times int, matchers ...Matcher) bool {
+	t.Helper()
+
+	matching := fake.matching(key, matchers)
+	if len(matching) == times {
+		return true
+	}
+
+	t.Errorf("expected command %s to be sent %d time(s)%s but it was sent %d time(s)\n%s",
+		key, times, describeMatchers(matchers), len(matching), fake.explain(key, matchers))
+
+	return false
+}
+
+// AssertNotSent asserts that no command with the given key that satisfies all the matchers was received.
+func (fake *Fake) AssertNotSent(t testing.TB, key string, matchers ...Matcher) bool {
+	t.Helper()
+
+	return fake.AssertSentTimes(t, key, 0, matchers...)
+}
+
+func (fake *Fake) matching(key string, matchers []Matcher) []commander.Command {
+	var matching []commander.Command
+
+	for _, command := range fake.CommandsWithKey(key) {
+		if len(mismatches(command, matchers)) == 0 {
+			matching = append(matching, command)
+		}
+	}
+
+	return matching
+}
+
+// explain describes every received command with the given key and why it didn't match, or lists
+// the keys of the commands received if there are none with the key.
+func (fake *Fake) explain(key string, matchers []Matcher) string {
+	builder := strings.Builder{}
+
+	commands := fake.CommandsWithKey(key)
+	if len(commands) == 0 {
+		keys := []string{}
+		for _, command := range fake.Commands() {
+			keys = append(keys, command.Key())
+		}
+
+		builder.WriteString(fmt.Sprintf("no %s command was received; received commands: [%s]\n", key, strings.Join(keys, ", ")))
+
+		return builder.String()
+	}
+
+	for i, command := range commands {
+		builder.WriteString(fmt.Sprintf("received %s #%d: %+v\n", key, i+1, command))
+
+		for _, mismatch := range mismatches(command, matchers) {
+			builder.WriteString(indent(mismatch, "    "))
+			builder.WriteString("\n")
+		}
+	}
+
+	return builder.String()
+}
+
+func mismatches(command commander.Command, matchers []Matcher) []string {
+	var result []string
+
+	for _, matcher := range matchers {
+		if ok, mismatch := matcher.Match(command); !ok {
+			result = append(result, mismatch)
+		}
+	}
+
+	return result
+}
+
+func describeMatchers(matchers []Matcher) string {
+	if len(matchers) == 0 {
+		return ""
+	}
+
+	descriptions := make([]string, 0, len(matchers))
+	for _, matcher := range matchers {
+		descriptions = append(descriptions, matcher.String())
+	}
+
+	return fmt.Sprintf(" with %s", strings.Join(descriptions, " and "))
+}
+
+func indent(s string, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,111 @@
+package commandertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+type createTenant struct {
+	Name   string
+	Region string
+}
+
+func (c *createTenant) Key() string {
+	return "CreateTenant"
+}
+
+type deleteTenant struct {
+	Id string
+}
+
+func (c deleteTenant) Key() string {
+	return "DeleteTenant"
+}
+
+// recordingT records the failures of the assertions instead of failing the test.
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+func TestFake(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	ctx := context.Background()
+
+	t.Run("should return canned results and record commands", func(t *testing.T) {
+		errNotFound := errors.New("not found")
+		fake := NewFake().
+			Returns("DeleteTenant", nil, errNotFound).
+			HandleFunc("CreateTenant", func(ctx context.Context, command commander.Command) (any, error) {
+				return "id-" + command.(*createTenant).Name, nil
+			})
+
+		result, err := commander.Send[string](ctx, fake, &createTenant{Name: "acme"})
+		require.NoError(t, err)
+		assert.Equal(t, "id-acme", result)
+
+		_, err = fake.Execute(ctx, deleteTenant{Id: "t-1"})
+		assert.ErrorIs(t, err, errNotFound)
+
+		assert.Len(t, fake.Commands(), 2)
+		assert.Equal(t, []commander.Command{deleteTenant{Id: "t-1"}}, fake.CommandsWithKey("DeleteTenant"))
+
+		fake.Reset()
+		assert.Empty(t, fake.Commands())
+	})
+
+	t.Run("should pass assertions on matching commands", func(t *testing.T) {
+		fake := NewFake()
+		_, _ = fake.Execute(ctx, &createTenant{Name: "acme", Region: "eu"})
+		_, _ = fake.Execute(ctx, &createTenant{Name: "initech", Region: "us"})
+
+		assert.True(t, fake.AssertSent(t, "CreateTenant", Fields(map[string]any{"Name": "acme"})))
+		assert.True(t, fake.AssertSentOnce(t, "CreateTenant", Equal(&createTenant{Name: "initech", Region: "us"})))
+		assert.True(t, fake.AssertSentTimes(t, "CreateTenant", 2))
+		assert.True(t, fake.AssertSentTimes(t, "CreateTenant", 2, MatchFunc("a region", func(command commander.Command) bool {
+			return command.(*createTenant).Region != ""
+		})))
+		assert.True(t, fake.AssertNotSent(t, "DeleteTenant"))
+	})
+
+	t.Run("should explain why no command matched", func(t *testing.T) {
+		fake := NewFake()
+		_, _ = fake.Execute(ctx, &createTenant{Name: "acme", Region: "eu"})
+
+		recorder := &recordingT{TB: t}
+		assert.False(t, fake.AssertSent(recorder, "CreateTenant",
+			Fields(map[string]any{"Name": "acme", "Region": "us"}),
+			Equal(&createTenant{Name: "acme", Region: "us"}),
+		))
+
+		require.Len(t, recorder.failures, 1)
+		assert.Contains(t, recorder.failures[0], `field Region: expected "us" but got "eu"`)
+		assert.Contains(t, recorder.failures[0], `-  Region: (string) (len=2) "us"`)
+		assert.Contains(t, recorder.failures[0], `+  Region: (string) (len=2) "eu"`)
+	})
+
+	t.Run("should list the received commands when none has the key", func(t *testing.T) {
+		fake := NewFake()
+		_, _ = fake.Execute(ctx, &createTenant{Name: "acme"})
+
+		recorder := &recordingT{TB: t}
+		assert.False(t, fake.AssertSentOnce(recorder, "DeleteTenant"))
+
+		require.Len(t, recorder.failures, 1)
+		assert.Contains(t, recorder.failures[0], "received commands: [CreateTenant]")
+	})
+}
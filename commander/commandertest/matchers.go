@@ -0,0 +1,158 @@
+package commandertest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/stretchr/testify/assert"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+)
+
+// Matcher checks a received command. If the command doesn't match, Match returns a description of
+// the mismatch that is shown in the assertion failure.
+type Matcher interface {
+	Match(command commander.Command) (ok bool, mismatch string)
+	String() string
+}
+
+type equalMatcher struct {
+	expected commander.Command
+}
+
+// Equal matches commands that are equal to expected. Mismatches are shown as a diff.
+func Equal(expected commander.Command) Matcher {
+	return equalMatcher{expected: expected}
+}
+
+func (matcher equalMatcher) Match(command commander.Command) (bool, string) {
+	if assert.ObjectsAreEqual(matcher.expected, command) {
+		return true, ""
+	}
+
+	return false, "not equal:\n" + diff(matcher.expected, command)
+}
+
+func (matcher equalMatcher) String() string {
+	return fmt.Sprintf("%+v", matcher.expected)
+}
+
+type fieldsMatcher struct {
+	fields map[string]any
+}
+
+// Fields matches commands whose exported fields have the given values. Fields not listed are ignored.
+// The command must be a struct or a pointer to a struct.
+func Fields(fields map[string]any) Matcher {
+	return fieldsMatcher{fields: fields}
+}
+
+func (matcher fieldsMatcher) Match(command commander.Command) (bool, string) {
+	value := reflect.ValueOf(command)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return false, "command is a nil pointer"
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return false, fmt.Sprintf("command of type %T is not a struct", command)
+	}
+
+	var mismatches []string
+
+	for _, name := range matcher.names() {
+		expected := matcher.fields[name]
+
+		field := value.FieldByName(name)
+		if !field.IsValid() {
+			mismatches = append(mismatches, fmt.Sprintf("field %s: does not exist on %T", name, command))
+			continue
+		}
+
+		if !field.CanInterface() {
+			mismatches = append(mismatches, fmt.Sprintf("field %s: is not exported", name))
+			continue
+		}
+
+		actual := field.Interface()
+		if !assert.ObjectsAreEqualValues(expected, actual) {
+			mismatches = append(mismatches, fmt.Sprintf("field %s: expected %#v but got %#v", name, expected, actual))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return false, strings.Join(mismatches, "\n")
+	}
+
+	return true, ""
+}
+
+func (matcher fieldsMatcher) String() string {
+	pairs := make([]string, 0, len(matcher.fields))
+	for _, name := range matcher.names() {
+		pairs = append(pairs, fmt.Sprintf("%s=%#v", name, matcher.fields[name]))
+	}
+
+	return fmt.Sprintf("fields {%s}", strings.Join(pairs, ", "))
+}
+
+func (matcher fieldsMatcher) names() []string {
+	names := make([]string, 0, len(matcher.fields))
+	for name := range matcher.fields {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+type funcMatcher struct {
+	description string
+	fn          func(command commander.Command) bool
+}
+
+// MatchFunc matches commands for which fn returns true. The description is shown in assertion failures.
+func MatchFunc(description string, fn func(command commander.Command) bool) Matcher {
+	return funcMatcher{description: description, fn: fn}
+}
+
+func (matcher funcMatcher) Match(command commander.Command) (bool, string) {
+	if matcher.fn(command) {
+		return true, ""
+	}
+
+	return false, fmt.Sprintf("does not satisfy %s", matcher.description)
+}
+
+func (matcher funcMatcher) String() string {
+	return matcher.description
+}
+
+var spewConfig = spew.ConfigState{
+	Indent:                  "  ",
+	DisablePointerAddresses: true,
+	DisableCapacities:       true,
+	SortKeys:                true,
+}
+
+func diff(expected any, actual any) string {
+	unified, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(spewConfig.Sdump(expected)),
+		B:        difflib.SplitLines(spewConfig.Sdump(actual)),
+		FromFile: "Expected",
+		ToFile:   "Actual",
+		Context:  1,
+	})
+	if err != nil {
+		return fmt.Sprintf("expected %+v\nactual   %+v", expected, actual)
+	}
+
+	return unified
+}
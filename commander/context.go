@@ -0,0 +1,36 @@
+package commander
+
+import (
+	"context"
+
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/auditeventspublisher"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/correlation"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/jwtverifier"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+// detachContext returns a new background context that carries the request-scoped values of ctx
+// (logger, correlation ids, audit events publisher and caller identity) but not its cancellation
+// or deadline. It is used to run commands that outlive the caller, e.g. on a worker of the AsyncCommander.
+func detachContext(ctx context.Context) context.Context {
+	detached := context.Background()
+
+	detached = log.NewContext(detached, log.FromContext(ctx))
+	detached = correlation.NewContext(detached, correlation.FromContext(ctx))
+
+	if clientCorrelationId := correlation.FromContextWithClientCorrelationId(ctx); clientCorrelationId != "" {
+		detached = correlation.NewContextWithClientCorrelationId(detached, clientCorrelationId)
+	}
+
+	detached = auditeventspublisher.NewContext(detached, auditeventspublisher.FromContext(ctx))
+
+	if claims := jwtverifier.ClaimsFromContext(ctx); claims != nil {
+		detached = jwtverifier.NewContext(detached, claims)
+	}
+
+	if identity, ok := ServiceIdentityFromContext(ctx); ok {
+		detached = NewServiceIdentityContext(detached, identity)
+	}
+
+	return detached
+}
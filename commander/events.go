@@ -0,0 +1,112 @@
+package commander
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/auditeventspublisher"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+type eventsContextKey int
+
+const (
+	eventCollectorKey eventsContextKey = iota
+)
+
+// EventCollector collects the domain events raised while a command is handled. The Commander puts a
+// new EventCollector in the context of every command it executes and publishes the collected events,
+// in the order they were raised, once the handler has returned successfully. The events are discarded
+// if the handler returns an error. Since the command has already succeeded, an event that fails to be
+// published is logged as an error and doesn't change the command's result.
+//
+// Commands executed from within a handler with the same context add their events to the outer command's
+// collector, so they are only published once the outermost command succeeds.
+type EventCollector struct {
+	mutex  sync.Mutex
+	events []any
+}
+
+// Raise adds the events to the collector.
+func (collector *EventCollector) Raise(events ...any) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	collector.events = append(collector.events, events...)
+}
+
+// Events returns a copy of the events collected so far.
+func (collector *EventCollector) Events() []any {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	events := make([]any, len(collector.events))
+	copy(events, collector.events)
+
+	return events
+}
+
+// RaiseEvent adds the events to the EventCollector of the command being handled with ctx.
+// If ctx doesn't come from the Commander, the events are logged as a warning and dropped.
+func RaiseEvent(ctx context.Context, events ...any) {
+	collector := EventCollectorFromContext(ctx)
+	if collector == nil {
+		log.FromContext(ctx).Warnw("Event collector not found in context -- dropping domain events",
+			"events", events,
+		)
+
+		return
+	}
+
+	collector.Raise(events...)
+}
+
+// NewEventContext creates a new context enriched with the event collector.
+func NewEventContext(ctx context.Context, collector *EventCollector) context.Context {
+	return context.WithValue(ctx, eventCollectorKey, collector)
+}
+
+// EventCollectorFromContext returns the event collector from the given context or nil if there is none.
+func EventCollectorFromContext(ctx context.Context) *EventCollector {
+	if collector, ok := ctx.Value(eventCollectorKey).(*EventCollector); ok {
+		return collector
+	}
+
+	return nil
+}
+
+// handleWithEvents invokes the handler with a new EventCollector in the context and, if it succeeds,
+// either hands the collected events to the outer command's collector or publishes them with the
+// auditeventspublisher.AuditEventsPublisher from the context. Events that fail to be published are
+// logged and the remaining events are still published.
+func handleWithEvents(ctx context.Context, handler Handler, command Command) (any, error) {
+	collector := &EventCollector{}
+
+	result, err := handler.HandleIt(NewEventContext(ctx, collector), command)
+	if err != nil {
+		return result, err
+	}
+
+	events := collector.Events()
+
+	if parent := EventCollectorFromContext(ctx); parent != nil {
+		parent.Raise(events...)
+
+		return result, nil
+	}
+
+	publisher := auditeventspublisher.FromContext(ctx)
+
+	// the command's side effects are already committed, so a failure to publish an event is only logged
+	// rather than reported as a failure of the command, which could be retried
+	for _, event := range events {
+		if err := publisher.Publish(ctx, event); err != nil {
+			log.FromContext(ctx).Errorw(fmt.Sprintf("Command %s succeeded but publishing one of its events failed", command.Key()),
+				"event", fmt.Sprintf("%T", event),
+				"error", err)
+		}
+	}
+
+	return result, nil
+}
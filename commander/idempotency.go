@@ -0,0 +1,343 @@
+package commander
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/jwtverifier"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+// IdempotentCommand is a Command that carries a client supplied idempotency key. The IdempotencyBehavior
+// executes commands with the same key at most once within its window. An empty key disables idempotency
+// for that command.
+type IdempotentCommand interface {
+	Command
+	IdempotencyKey() string
+}
+
+// IdempotentResultCommand can be implemented by an IdempotentCommand to have its stored result decoded
+// into the value NewIdempotencyResult returns, which must be a pointer to the result type, e.g.
+// new(*Tenant) for a command whose result is a *Tenant. Otherwise the stored result is decoded into the
+// generic JSON types, i.e. map[string]any, []any, string, float64 or bool.
+type IdempotentResultCommand interface {
+	IdempotentCommand
+	NewIdempotencyResult() any
+}
+
+const (
+	// errorKindValidation is the ErrKind of a stored *ValidationError.
+	errorKindValidation = "validation"
+
+	// errorKindForbidden is the ErrKind of a stored *ForbiddenError.
+	errorKindForbidden = "forbidden"
+)
+
+// IdempotencyRecord is the stored outcome of an idempotent command. It only holds plain data so that
+// stores can serialize it.
+type IdempotencyRecord struct {
+	// Result is the JSON encoded result of the command.
+	Result []byte `json:"result,omitempty"`
+
+	// Err is the message of the error returned by the command, empty if it succeeded.
+	Err string `json:"error,omitempty"`
+
+	// ErrKind tells which typed error ErrDetail holds, e.g. "validation", empty for any other error.
+	ErrKind string `json:"errorKind,omitempty"`
+
+	// ErrDetail is the JSON encoded typed error, so that it can be returned with the same type again.
+	ErrDetail []byte `json:"errorDetail,omitempty"`
+}
+
+// StoredError is returned in place of the error of an idempotent command when the stored outcome is
+// returned to a later execution and the original error couldn't be restored with its type. Only the
+// message of the original error is kept.
+type StoredError struct {
+	Key     string
+	Message string
+}
+
+func (e *StoredError) Error() string {
+	return e.Message
+}
+
+// IdempotencyStore keeps track of the idempotent commands that are being executed or have been executed.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Acquire claims the key for execution. If the key was claimed before and its record hasn't expired,
+	// it waits for the execution to complete and returns its record with acquired set to false. If the
+	// key is free, acquired is true and the caller must call either Complete or Release.
+	Acquire(ctx context.Context, key string) (record *IdempotencyRecord, acquired bool, err error)
+
+	// Complete stores the record for the key. It is kept for the given window.
+	Complete(ctx context.Context, key string, record IdempotencyRecord, window time.Duration) error
+
+	// Release frees the key without storing a record so that the next caller executes the command.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyBehavior executes each IdempotentCommand at most once within window. Later executions
+// by the same caller with the same command key and idempotency key return the stored result, decoded
+// as described by IdempotentResultCommand, or the stored *ValidationError or *ForbiddenError, so that it
+// renders with the same status. The caller is identified by the subject and tenant claims from
+// jwtverifier.ClaimsFromContext or, if there are none, by the ServiceIdentity in the context. Concurrent
+// duplicates wait for the first execution to complete. Executions that fail with any other error, which
+// may be transient, are not stored, so that the next execution tries again.
+func IdempotencyBehavior(store IdempotencyStore, window time.Duration) Behavior {
+	return func(next Handler) Handler {
+		fn := func(ctx context.Context, command Command) (any, error) {
+			idempotent, ok := command.(IdempotentCommand)
+			if !ok || idempotent.IdempotencyKey() == "" {
+				return next.HandleIt(ctx, command)
+			}
+
+			key := idempotencyStoreKey(ctx, idempotent)
+
+			record, acquired, err := store.Acquire(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+
+			if !acquired {
+				log.FromContext(ctx).Infow("Returning stored result of idempotent command", "command", command.Key(), "idempotencyKey", idempotent.IdempotencyKey())
+
+				return replay(idempotent, record)
+			}
+
+			completed := false
+			defer func() {
+				// the handler panicked, let the next caller try again
+				if !completed {
+					_ = store.Release(context.Background(), key)
+				}
+			}()
+
+			result, err := next.HandleIt(ctx, command)
+			completed = true
+
+			outcome, storable := newIdempotencyRecord(result, err)
+			if !storable {
+				if releaseErr := store.Release(ctx, key); releaseErr != nil {
+					log.FromContext(ctx).Errorw("Failed to release idempotency key", "key", key, "error", releaseErr)
+				}
+
+				return result, err
+			}
+
+			if completeErr := store.Complete(ctx, key, outcome, window); completeErr != nil {
+				log.FromContext(ctx).Errorw("Failed to store the result of idempotent command", "key", key, "error", completeErr)
+			}
+
+			return result, err
+		}
+		return HandlerFunc(fn)
+	}
+}
+
+// idempotencyStoreKey scopes the idempotency key of the command to its key and to the caller, so that
+// callers can't get each other's results by reusing an idempotency key.
+func idempotencyStoreKey(ctx context.Context, command IdempotentCommand) string {
+	var tenant, subject string
+
+	if claims := jwtverifier.ClaimsFromContext(ctx); claims != nil {
+		tenant, _ = claims[TenantClaim].(string)
+		subject, _ = claims[SubjectClaim].(string)
+	} else if identity, ok := ServiceIdentityFromContext(ctx); ok {
+		subject = "service:" + identity.Name
+	}
+
+	return fmt.Sprintf("%s:%q:%q:%s", command.Key(), tenant, subject, command.IdempotencyKey())
+}
+
+// newIdempotencyRecord encodes the outcome of a command. It returns false if the outcome must not be
+// stored, i.e. the command failed with an error other than a *ValidationError or a *ForbiddenError. A
+// result that can't be encoded is stored as an error, so that duplicates still aren't executed.
+func newIdempotencyRecord(result any, err error) (IdempotencyRecord, bool) {
+	if err != nil {
+		var (
+			validationErr *ValidationError
+			forbiddenErr  *ForbiddenError
+			kind          string
+			typed         error
+		)
+
+		switch {
+		case errors.As(err, &validationErr):
+			kind, typed = errorKindValidation, validationErr
+		case errors.As(err, &forbiddenErr):
+			kind, typed = errorKindForbidden, forbiddenErr
+		default:
+			return IdempotencyRecord{}, false
+		}
+
+		detail, encodeErr := json.Marshal(typed)
+		if encodeErr != nil {
+			return IdempotencyRecord{Err: err.Error()}, true
+		}
+
+		return IdempotencyRecord{Err: err.Error(), ErrKind: kind, ErrDetail: detail}, true
+	}
+
+	encoded, encodeErr := json.Marshal(result)
+	if encodeErr != nil {
+		return IdempotencyRecord{Err: fmt.Sprintf("the result of the command could not be stored: %v", encodeErr)}, true
+	}
+
+	return IdempotencyRecord{Result: encoded}, true
+}
+
+// replay decodes the stored outcome of a command.
+func replay(command IdempotentCommand, record *IdempotencyRecord) (any, error) {
+	if record.Err != "" {
+		return nil, replayError(command, record)
+	}
+
+	var target any = new(any)
+	if resultCommand, ok := command.(IdempotentResultCommand); ok {
+		target = resultCommand.NewIdempotencyResult()
+	}
+
+	if err := json.Unmarshal(record.Result, target); err != nil {
+		return nil, fmt.Errorf("could not decode the stored result of command %s: %w", command.Key(), err)
+	}
+
+	return reflect.ValueOf(target).Elem().Interface(), nil
+}
+
+// replayError restores the stored error with its type or, if it had none, as a *StoredError.
+func replayError(command IdempotentCommand, record *IdempotencyRecord) error {
+	switch record.ErrKind {
+	case errorKindValidation:
+		validationErr := &ValidationError{}
+		if err := json.Unmarshal(record.ErrDetail, validationErr); err == nil {
+			validationErr.Key = command.Key()
+			return validationErr
+		}
+	case errorKindForbidden:
+		forbiddenErr := &ForbiddenError{}
+		if err := json.Unmarshal(record.ErrDetail, forbiddenErr); err == nil {
+			forbiddenErr.Key = command.Key()
+			return forbiddenErr
+		}
+	}
+
+	return &StoredError{Key: command.Key(), Message: record.Err}
+}
+
+type idempotencyEntry struct {
+	done      chan struct{}
+	record    IdempotencyRecord
+	expiresAt time.Time
+}
+
+// InMemoryIdempotencyStore is an IdempotencyStore that keeps the records in memory. It only deduplicates
+// commands executed by the same process.
+type InMemoryIdempotencyStore struct {
+	mutex     sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+var _ IdempotencyStore = &InMemoryIdempotencyStore{}
+
+// NewInMemoryIdempotencyStore creates an empty InMemoryIdempotencyStore.
+func NewInMemoryIdempotencyStore() *InMemoryIdempotencyStore {
+	return &InMemoryIdempotencyStore{
+		entries: map[string]*idempotencyEntry{},
+	}
+}
+
+func (store *InMemoryIdempotencyStore) Acquire(ctx context.Context, key string) (*IdempotencyRecord, bool, error) {
+	for {
+		now := time.Now()
+
+		store.mutex.Lock()
+		store.removeExpired(now)
+
+		entry, ok := store.entries[key]
+		if !ok || entry.expired(now) {
+			store.entries[key] = &idempotencyEntry{done: make(chan struct{})}
+			store.mutex.Unlock()
+
+			return nil, true, nil
+		}
+
+		store.mutex.Unlock()
+
+		select {
+		case <-entry.done:
+			// the entry is either completed or released, in which case the key is free to acquire again
+			store.mutex.Lock()
+			current := store.entries[key]
+			store.mutex.Unlock()
+
+			if current == entry {
+				record := entry.record
+				return &record, false, nil
+			}
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+func (store *InMemoryIdempotencyStore) Complete(ctx context.Context, key string, record IdempotencyRecord, window time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	entry, ok := store.entries[key]
+	if !ok {
+		return fmt.Errorf("idempotency key %s was not acquired", key)
+	}
+
+	entry.record = record
+	entry.expiresAt = time.Now().Add(window)
+	close(entry.done)
+
+	return nil
+}
+
+func (store *InMemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	entry, ok := store.entries[key]
+	if !ok {
+		return nil
+	}
+
+	delete(store.entries, key)
+
+	select {
+	case <-entry.done:
+	default:
+		close(entry.done)
+	}
+
+	return nil
+}
+
+// removeExpired deletes the completed entries whose window has passed, at most once per second.
+// The mutex must be held.
+func (store *InMemoryIdempotencyStore) removeExpired(now time.Time) {
+	if now.Sub(store.lastSweep) < time.Second {
+		return
+	}
+
+	store.lastSweep = now
+
+	for key, entry := range store.entries {
+		if entry.expired(now) {
+			delete(store.entries, key)
+		}
+	}
+}
+
+func (entry *idempotencyEntry) expired(now time.Time) bool {
+	return !entry.expiresAt.IsZero() && now.After(entry.expiresAt)
+}
@@ -0,0 +1,300 @@
+package commander
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+// Query is the read side counterpart of Command. It is dispatched by a QueryBus to the QueryHandler
+// registered for its key.
+type Query interface {
+	Key() string
+}
+
+type QueryHandler interface {
+	HandleIt(ctx context.Context, query Query) (any, error)
+}
+
+// QueryHandlerFunc is an adapter to allow the use of ordinary functions as a QueryHandler.
+type QueryHandlerFunc func(ctx context.Context, query Query) (any, error)
+
+// HandleIt calls f(ctx, query).
+func (f QueryHandlerFunc) HandleIt(ctx context.Context, query Query) (any, error) {
+	return f(ctx, query)
+}
+
+// CacheableQuery is a Query whose results are cached by the QueryBus. The TTL is read from the zero query
+// given when the handler is registered. CacheKey must identify the query parameters, e.g. the id of the
+// requested resource, and is called on every query. The cached result is returned as is to every caller,
+// so results that are pointers, maps or slices are shared and must not be modified.
+type CacheableQuery interface {
+	Query
+	CacheKey() string
+	CacheTTL() time.Duration
+}
+
+// QueryExecutor is implemented by the QueryBus. Depend on it instead of *QueryBus to be able to fake it in tests.
+type QueryExecutor interface {
+	Ask(ctx context.Context, query Query) (any, error)
+}
+
+// QueryBusBuilder collects query handlers at startup and freezes them into a QueryBus with Build.
+// A QueryBusBuilder is not safe for concurrent use.
+type QueryBusBuilder struct {
+	handlers map[string]QueryHandler
+	ttls     map[string]time.Duration
+}
+
+// NewQueryBusBuilder creates an empty QueryBusBuilder.
+func NewQueryBusBuilder() *QueryBusBuilder {
+	return &QueryBusBuilder{
+		handlers: map[string]QueryHandler{},
+		ttls:     map[string]time.Duration{},
+	}
+}
+
+// Add registers the handler for the key of zeroQuery. If zeroQuery is a CacheableQuery with a positive
+// TTL, the results of the handler are cached. It returns a *DuplicateHandlerError if a handler was
+// already registered for the same key.
+func (builder *QueryBusBuilder) Add(handler QueryHandler, zeroQuery Query) error {
+	key := zeroQuery.Key()
+
+	if _, ok := builder.handlers[key]; ok {
+		return &DuplicateHandlerError{Key: key}
+	}
+
+	builder.handlers[key] = handler
+
+	if cacheable, ok := zeroQuery.(CacheableQuery); ok && cacheable.CacheTTL() > 0 {
+		builder.ttls[key] = cacheable.CacheTTL()
+	}
+
+	return nil
+}
+
+// Build returns a QueryBus with the handlers added so far.
+func (builder *QueryBusBuilder) Build() *QueryBus {
+	bus := &QueryBus{
+		handlers: make(map[string]QueryHandler, len(builder.handlers)),
+		caches:   map[string]*queryResults{},
+	}
+
+	for key, handler := range builder.handlers {
+		bus.handlers[key] = handler
+	}
+
+	for key, ttl := range builder.ttls {
+		bus.caches[key] = &queryResults{cache: cache.New(ttl, 2*ttl)}
+	}
+
+	return bus
+}
+
+// queryResults holds the cached results of a query. The generation is incremented by every invalidation, so
+// that a result computed while the query was invalidated isn't cached.
+type queryResults struct {
+	mutex      sync.Mutex
+	generation uint64
+	cache      *cache.Cache
+}
+
+func (results *queryResults) currentGeneration() uint64 {
+	results.mutex.Lock()
+	defer results.mutex.Unlock()
+
+	return results.generation
+}
+
+// set caches the result unless the query was invalidated since the given generation.
+func (results *queryResults) set(cacheKey string, result any, generation uint64) {
+	results.mutex.Lock()
+	defer results.mutex.Unlock()
+
+	if results.generation == generation {
+		results.cache.SetDefault(cacheKey, result)
+	}
+}
+
+// invalidate removes the results with the cache keys, or every result if there are none.
+func (results *queryResults) invalidate(cacheKeys []string) {
+	results.mutex.Lock()
+	defer results.mutex.Unlock()
+
+	results.generation++
+
+	if len(cacheKeys) == 0 {
+		results.cache.Flush()
+
+		return
+	}
+
+	for _, cacheKey := range cacheKeys {
+		results.cache.Delete(cacheKey)
+	}
+}
+
+// QueryBus dispatches queries to the handler registered for their key and caches the results of
+// CacheableQuery. It is safe for concurrent use.
+type QueryBus struct {
+	handlers map[string]QueryHandler
+	caches   map[string]*queryResults
+}
+
+var _ QueryExecutor = &QueryBus{}
+
+// Has returns true if a handler is registered for the given query key.
+func (bus *QueryBus) Has(key string) bool {
+	_, ok := bus.handlers[key]
+
+	return ok
+}
+
+// Handlers returns the sorted keys of all the queries that have a handler.
+func (bus *QueryBus) Handlers() []string {
+	keys := make([]string, 0, len(bus.handlers))
+	for key := range bus.handlers {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Ask dispatches the query to its handler. Results of a CacheableQuery are served from the cache
+// until they expire or are invalidated. Errors are never cached, and neither are results of queries that
+// were invalidated while they were handled, since they could be stale.
+func (bus *QueryBus) Ask(ctx context.Context, query Query) (any, error) {
+	handler, ok := bus.handlers[query.Key()]
+	if !ok {
+		err := fmt.Errorf("QueryBus encountered a query for which no handler was configured: %s", query.Key())
+
+		logger := log.FromContext(ctx)
+		logger.Error(err)
+
+		return nil, err
+	}
+
+	queryCache, cacheable := bus.caches[query.Key()]
+	if !cacheable {
+		return handler.HandleIt(ctx, query)
+	}
+
+	var cacheKey string
+	if cacheableQuery, ok := query.(CacheableQuery); ok {
+		cacheKey = cacheableQuery.CacheKey()
+	}
+
+	if result, found := queryCache.cache.Get(cacheKey); found {
+		return result, nil
+	}
+
+	generation := queryCache.currentGeneration()
+
+	result, err := handler.HandleIt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	queryCache.set(cacheKey, result, generation)
+
+	return result, nil
+}
+
+// Invalidate removes the cached results of the query with the given key. If cacheKeys are given, only
+// the results with those cache keys are removed, otherwise every cached result of the query is removed.
+func (bus *QueryBus) Invalidate(queryKey string, cacheKeys ...string) {
+	queryCache, ok := bus.caches[queryKey]
+	if !ok {
+		return
+	}
+
+	queryCache.invalidate(cacheKeys)
+}
+
+// Ask dispatches the query with the given QueryExecutor and converts the result to R.
+// See Send for how the result is converted.
+func Ask[R any](ctx context.Context, executor QueryExecutor, query Query) (R, error) {
+	result, err := executor.Ask(ctx, query)
+
+	return typedResult[R]("query", query.Key(), result, err)
+}
+
+// InvalidatingCommand can be implemented by a Command to declare the keys of the queries whose cached
+// results become stale once it succeeds. It requires the InvalidationBehavior.
+type InvalidatingCommand interface {
+	InvalidatesQueries() []string
+}
+
+type invalidationsContextKey int
+
+const (
+	invalidationsKey invalidationsContextKey = iota
+)
+
+type queryInvalidation struct {
+	queryKey  string
+	cacheKeys []string
+}
+
+type pendingInvalidations struct {
+	mutex         sync.Mutex
+	invalidations []queryInvalidation
+}
+
+// InvalidateQuery marks the cached results of the query with the given key as stale. It is meant to be
+// called from a command handler and takes effect once the command succeeds. See QueryBus.Invalidate for
+// the meaning of cacheKeys. It requires the InvalidationBehavior.
+func InvalidateQuery(ctx context.Context, queryKey string, cacheKeys ...string) {
+	pending, ok := ctx.Value(invalidationsKey).(*pendingInvalidations)
+	if !ok {
+		log.FromContext(ctx).Warnw("InvalidationBehavior not found in context -- query cache was not invalidated",
+			"query", queryKey,
+		)
+
+		return
+	}
+
+	pending.mutex.Lock()
+	defer pending.mutex.Unlock()
+
+	pending.invalidations = append(pending.invalidations, queryInvalidation{queryKey: queryKey, cacheKeys: cacheKeys})
+}
+
+// InvalidationBehavior invalidates the cached query results in the bus once a command succeeds. The queries
+// to invalidate are declared by commands that implement InvalidatingCommand, or requested by the handler
+// with InvalidateQuery. Nothing is invalidated if the handler returns an error.
+func InvalidationBehavior(bus *QueryBus) Behavior {
+	return func(next Handler) Handler {
+		fn := func(ctx context.Context, command Command) (any, error) {
+			pending := &pendingInvalidations{}
+
+			result, err := next.HandleIt(context.WithValue(ctx, invalidationsKey, pending), command)
+			if err != nil {
+				return result, err
+			}
+
+			if invalidating, ok := command.(InvalidatingCommand); ok {
+				for _, queryKey := range invalidating.InvalidatesQueries() {
+					bus.Invalidate(queryKey)
+				}
+			}
+
+			pending.mutex.Lock()
+			defer pending.mutex.Unlock()
+
+			for _, invalidation := range pending.invalidations {
+				bus.Invalidate(invalidation.queryKey, invalidation.cacheKeys...)
+			}
+
+			return result, nil
+		}
+		return HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,131 @@
+package commander
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DuplicateHandlerError is returned by RegistryBuilder.Add and Register when a handler is already registered for the command key.
+type DuplicateHandlerError struct {
+	Key string
+}
+
+func (e *DuplicateHandlerError) Error() string {
+	return fmt.Sprintf("a handler is already registered for command %s", e.Key)
+}
+
+// RegistryBuilder collects handlers at startup and freezes them into a read-only Registry with Build.
+// A RegistryBuilder is not safe for concurrent use.
+type RegistryBuilder struct {
+	handlers map[string]Handler
+}
+
+// NewRegistryBuilder creates an empty RegistryBuilder.
+func NewRegistryBuilder() *RegistryBuilder {
+	return &RegistryBuilder{
+		handlers: map[string]Handler{},
+	}
+}
+
+// Add registers the handler for the key of zeroCommand. It returns a *DuplicateHandlerError
+// if a handler was already registered for the same key.
+func (builder *RegistryBuilder) Add(handler Handler, zeroCommand Command) error {
+	key := zeroCommand.Key()
+
+	if _, ok := builder.handlers[key]; ok {
+		return &DuplicateHandlerError{Key: key}
+	}
+
+	builder.handlers[key] = handler
+
+	return nil
+}
+
+// Build returns a read-only Registry with the handlers added so far. Handlers added to the builder
+// afterwards are not visible to the returned Registry.
+func (builder *RegistryBuilder) Build() *Registry {
+	handlers := make(map[string]Handler, len(builder.handlers))
+	for key, handler := range builder.handlers {
+		handlers[key] = handler
+	}
+
+	return &Registry{handlers: handlers}
+}
+
+// AddTyped registers a TypedHandler with the builder. See Register for how the command key is determined.
+func AddTyped[C Command, R any](builder *RegistryBuilder, handler TypedHandler[C, R]) error {
+	return builder.Add(typedHandler[C, R]{handler: handler}, ZeroCommand[C]())
+}
+
+// Registry is a read-only set of handlers keyed by Command.Key(). It is safe for concurrent use.
+// A nil *Registry is an empty registry.
+type Registry struct {
+	handlers map[string]Handler
+}
+
+// Handler returns the handler registered for the given command key.
+func (registry *Registry) Handler(key string) (Handler, bool) {
+	if registry == nil {
+		return nil, false
+	}
+
+	handler, ok := registry.handlers[key]
+
+	return handler, ok
+}
+
+// Has returns true if a handler is registered for the given command key.
+func (registry *Registry) Has(key string) bool {
+	_, ok := registry.Handler(key)
+
+	return ok
+}
+
+// Handlers returns the sorted keys of all the registered commands.
+func (registry *Registry) Handlers() []string {
+	if registry == nil {
+		return []string{}
+	}
+
+	keys := make([]string, 0, len(registry.handlers))
+	for key := range registry.handlers {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Require returns an error listing every given command key that has no handler.
+// It is meant to be called at startup to fail fast on missing registrations.
+func (registry *Registry) Require(keys ...string) error {
+	var missing []string
+
+	for _, key := range keys {
+		if !registry.Has(key) {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("no handler was configured for the commands: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// with returns a copy of the registry with the handler set for the key, replacing any existing one.
+func (registry *Registry) with(key string, handler Handler) *Registry {
+	handlers := map[string]Handler{}
+	if registry != nil {
+		for existingKey, existingHandler := range registry.handlers {
+			handlers[existingKey] = existingHandler
+		}
+	}
+
+	handlers[key] = handler
+
+	return &Registry{handlers: handlers}
+}
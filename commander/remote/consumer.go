@@ -0,0 +1,234 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/teris-io/shortid"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/brokerclient"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/correlation"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/jwtverifier"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+type decoder func(payload []byte) (commander.Command, error)
+
+// Consumer executes the commands received from other services with a local commander.Executor and
+// publishes the replies. Only the commands registered with Accept are decoded.
+//
+// The commands are executed with the claims of the caller only if the Consumer and the sending Dispatcher
+// share a signing key, see WithSigningKey. Otherwise, or if the caller has no claims, they are executed
+// without any identity, even if the context given to Handle has a commander.ServiceIdentity, so they are only
+// authorized if they require no scope or role. A signed envelope is only accepted once, within the maximum age
+// set with WithMaxAge, and only while the claims of the caller haven't expired.
+type Consumer struct {
+	executor   commander.Executor
+	publisher  brokerclient.Publisher
+	decoders   map[string]decoder
+	signingKey []byte
+	maxAge     time.Duration
+
+	mutex  sync.Mutex
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+// NewConsumer creates a Consumer that executes the commands with executor and publishes the replies
+// with publisher.
+func NewConsumer(executor commander.Executor, publisher brokerclient.Publisher, opts ...Option) *Consumer {
+	options := newOptions(opts)
+
+	return &Consumer{
+		executor:   executor,
+		publisher:  publisher,
+		decoders:   map[string]decoder{},
+		signingKey: options.signingKey,
+		maxAge:     options.maxAge,
+		seen:       map[string]time.Time{},
+	}
+}
+
+// Accept registers the command type C with the consumer so that envelopes with its key are decoded into C.
+// The key is taken from the zero value of C, or a newly allocated value if C is a pointer type.
+// Accept must be called before the consumer starts handling messages.
+func Accept[C commander.Command](consumer *Consumer) {
+	consumer.decoders[commander.ZeroCommand[C]().Key()] = func(payload []byte) (commander.Command, error) {
+		command := commander.ZeroCommand[C]()
+
+		err := json.Unmarshal(payload, &command)
+
+		return command, err
+	}
+}
+
+// Handle decodes the command envelope in the message and executes the command with the correlation id of
+// the sender. If the sender expects a reply, the result or the error of the command is published to the
+// reply-to destination, see RemoteError for which error messages are sent back. Handle only returns an
+// error if the message could not be processed, e.g. it couldn't be decoded or the reply couldn't be
+// published, not if the command itself failed.
+func (consumer *Consumer) Handle(ctx context.Context, msg *brokerclient.BrokerMessage) error {
+	var envelope Envelope
+	if err := json.Unmarshal(msg.Content, &envelope); err != nil {
+		return fmt.Errorf("could not decode command envelope: %w", err)
+	}
+
+	if envelope.CorrelationId != "" {
+		ctx = correlation.NewContext(ctx, envelope.CorrelationId)
+	}
+
+	logger := log.FromContext(ctx).With("correlation-id", correlation.FromContext(ctx), "command", envelope.Key)
+	ctx = log.NewContext(ctx, logger)
+
+	result, err := consumer.execute(ctx, envelope)
+	if err != nil {
+		logger.Warnw("Remote command failed", "error", err)
+	}
+
+	if envelope.ReplyTo == "" {
+		return nil
+	}
+
+	reply := Reply{
+		Id:            envelope.Id,
+		CorrelationId: envelope.CorrelationId,
+	}
+
+	if err != nil {
+		reply.Code, reply.Error = replyError(ctx, err)
+	} else if result != nil {
+		reply.Result, err = json.Marshal(result)
+		if err != nil {
+			reply.Code, reply.Error = replyError(ctx, fmt.Errorf("could not encode result: %w", err))
+		}
+	}
+
+	replyMsg, err := newReplyMessage(envelope.ReplyTo, reply)
+	if err != nil {
+		return err
+	}
+
+	if err := consumer.publisher.Publish(ctx, replyMsg); err != nil {
+		logger.Errorw("Failed to publish reply of remote command", "error", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (consumer *Consumer) execute(ctx context.Context, envelope Envelope) (any, error) {
+	ctx, err := consumer.callerContext(ctx, envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	decode, ok := consumer.decoders[envelope.Key]
+	if !ok {
+		return nil, &commander.HandlerNotFoundError{Key: envelope.Key}
+	}
+
+	command, err := decode(envelope.Payload)
+	if err != nil {
+		return nil, commander.NewValidationError(envelope.Key, commander.FieldError{Message: fmt.Sprintf("could not decode the command: %v", err)})
+	}
+
+	return consumer.executor.Execute(ctx, command)
+}
+
+// callerContext verifies the signature and the age of the envelope, if the consumer has a signing key, and
+// replaces the identity in the context with the claims of the caller, if any.
+func (consumer *Consumer) callerContext(ctx context.Context, envelope Envelope) (context.Context, error) {
+	anonymous := commander.WithoutIdentity(ctx)
+
+	if consumer.signingKey == nil {
+		if len(envelope.Claims) > 0 {
+			log.FromContext(ctx).Warnw("Ignoring the claims of a remote command, since the consumer has no signing key to verify them")
+		}
+
+		return anonymous, nil
+	}
+
+	if !envelope.verify(consumer.signingKey) {
+		return nil, &commander.ForbiddenError{Key: envelope.Key, Message: "the command is not signed by a trusted sender"}
+	}
+
+	now := time.Now()
+
+	if age := envelope.age(now); age > consumer.maxAge || age < -consumer.maxAge {
+		return nil, &commander.ForbiddenError{Key: envelope.Key, Message: "the command is too old"}
+	}
+
+	if !consumer.firstSeen(envelope, now) {
+		return nil, &commander.ForbiddenError{Key: envelope.Key, Message: "the command was already received"}
+	}
+
+	if len(envelope.Claims) == 0 {
+		return anonymous, nil
+	}
+
+	var claims map[string]any
+	if err := json.Unmarshal(envelope.Claims, &claims); err != nil {
+		return nil, commander.NewValidationError(envelope.Key, commander.FieldError{Message: fmt.Sprintf("could not decode the claims: %v", err)})
+	}
+
+	if expiry, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(expiry), 0)) {
+		return nil, &commander.ForbiddenError{Key: envelope.Key, Message: "the claims of the caller are expired"}
+	}
+
+	return jwtverifier.NewContext(anonymous, claims), nil
+}
+
+// firstSeen records the id of the envelope and returns false if it was already received. The ids are
+// forgotten once the envelopes are older than the maximum age, since they are rejected then anyway.
+func (consumer *Consumer) firstSeen(envelope Envelope, now time.Time) bool {
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+
+	if now.Sub(consumer.pruned) > consumer.maxAge {
+		for id, issuedAt := range consumer.seen {
+			if now.Sub(issuedAt) > consumer.maxAge {
+				delete(consumer.seen, id)
+			}
+		}
+
+		consumer.pruned = now
+	}
+
+	if _, ok := consumer.seen[envelope.Id]; ok {
+		return false
+	}
+
+	consumer.seen[envelope.Id] = time.UnixMilli(envelope.IssuedAt)
+
+	return true
+}
+
+// replyError returns the code and the message of the error to send back to the caller. The messages of
+// errors other than validation, authorization and unsupported command errors are not sent back, since they
+// can leak details of the receiving service. They are logged with an error id that is sent back instead.
+func replyError(ctx context.Context, err error) (string, string) {
+	var (
+		validationErr *commander.ValidationError
+		forbiddenErr  *commander.ForbiddenError
+		notFoundErr   *commander.HandlerNotFoundError
+	)
+
+	switch {
+	case errors.As(err, &validationErr):
+		return ErrorCodeInvalid, validationErr.Error()
+	case errors.As(err, &forbiddenErr):
+		return ErrorCodeForbidden, forbiddenErr.Error()
+	case errors.As(err, &notFoundErr):
+		return ErrorCodeUnsupported, fmt.Sprintf("command %s is not supported", notFoundErr.Key)
+	}
+
+	errorId, _ := shortid.Generate()
+	log.FromContext(ctx).Errorw("Remote command failed with an internal error", "error", err, "errorId", errorId)
+
+	return ErrorCodeInternal, fmt.Sprintf("internal error (errorId %s)", errorId)
+}
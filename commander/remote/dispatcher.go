@@ -0,0 +1,237 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/teris-io/shortid"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/brokerclient"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/correlation"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/jwtverifier"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+type resultDecoder func(result json.RawMessage) (any, error)
+
+// Dispatcher publishes commands to another service. Replies are matched to the waiting caller by
+// feeding the messages received on the reply-to destination to HandleReply.
+//
+// A Dispatcher is a commander.Executor for the commands whose result type is registered with Expect,
+// so it can be used with commander.Send like a local Commander.
+type Dispatcher struct {
+	publisher   brokerclient.Publisher
+	destination string
+	replyTo     string
+	signingKey  []byte
+	results     map[string]resultDecoder
+	mutex       sync.Mutex
+	pending     map[string]chan Reply
+}
+
+var _ commander.Executor = &Dispatcher{}
+
+// NewDispatcher creates a Dispatcher that publishes commands to destination. replyTo is the destination
+// that the receiving service publishes replies to. It can be empty if the Dispatcher is only used with Send.
+func NewDispatcher(publisher brokerclient.Publisher, destination string, replyTo string, opts ...Option) *Dispatcher {
+	options := newOptions(opts)
+
+	return &Dispatcher{
+		publisher:   publisher,
+		destination: destination,
+		replyTo:     replyTo,
+		signingKey:  options.signingKey,
+		results:     map[string]resultDecoder{},
+		pending:     map[string]chan Reply{},
+	}
+}
+
+// Expect registers R as the result type of the command C, so that Execute decodes the results of C into R.
+// The key is taken from the zero value of C, or a newly allocated value if C is a pointer type.
+// Expect must be called before the dispatcher is used.
+//
+// Example:
+//
+//	remote.Expect[*CreateClient, *Client](dispatcher)
+//	client, err := commander.Send[*Client](ctx, dispatcher, &CreateClient{TenantId: tenantId})
+func Expect[C commander.Command, R any](dispatcher *Dispatcher) {
+	dispatcher.results[commander.ZeroCommand[C]().Key()] = func(raw json.RawMessage) (any, error) {
+		var result R
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return nil, err
+		}
+
+		return result, nil
+	}
+}
+
+// Send publishes the command without waiting for it to be executed.
+func (dispatcher *Dispatcher) Send(ctx context.Context, command commander.Command) error {
+	envelope, err := dispatcher.newEnvelope(ctx, command, "")
+	if err != nil {
+		return err
+	}
+
+	return dispatcher.publish(ctx, envelope)
+}
+
+// Execute publishes the command and waits for the reply or until ctx is done. The result is decoded into
+// the type registered for the command with Expect; an error is returned if there is none. If the command
+// failed remotely, a *RemoteError is returned.
+func (dispatcher *Dispatcher) Execute(ctx context.Context, command commander.Command) (any, error) {
+	raw, err := dispatcher.request(ctx, command)
+	if err != nil || len(raw) == 0 {
+		return nil, err
+	}
+
+	decode, ok := dispatcher.results[command.Key()]
+	if !ok {
+		return nil, fmt.Errorf("no result type is registered for remote command %s, register it with Expect", command.Key())
+	}
+
+	result, err := decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode result of remote command %s: %w", command.Key(), err)
+	}
+
+	return result, nil
+}
+
+// request publishes the command and waits for the reply or until ctx is done. It returns the JSON encoded
+// result.
+func (dispatcher *Dispatcher) request(ctx context.Context, command commander.Command) (json.RawMessage, error) {
+	if dispatcher.replyTo == "" {
+		return nil, errors.New("a reply-to destination is needed to wait for the reply of a remote command")
+	}
+
+	envelope, err := dispatcher.newEnvelope(ctx, command, dispatcher.replyTo)
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make(chan Reply, 1)
+
+	dispatcher.mutex.Lock()
+	dispatcher.pending[envelope.Id] = replies
+	dispatcher.mutex.Unlock()
+
+	defer func() {
+		dispatcher.mutex.Lock()
+		delete(dispatcher.pending, envelope.Id)
+		dispatcher.mutex.Unlock()
+	}()
+
+	if err := dispatcher.publish(ctx, envelope); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, &RemoteError{Key: command.Key(), Code: reply.Code, Message: reply.Error}
+		}
+
+		return reply.Result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// HandleReply matches a reply message to the caller waiting for it in Execute. Replies that nobody
+// is waiting for anymore are logged and dropped.
+func (dispatcher *Dispatcher) HandleReply(ctx context.Context, msg *brokerclient.BrokerMessage) error {
+	var reply Reply
+	if err := json.Unmarshal(msg.Content, &reply); err != nil {
+		return fmt.Errorf("could not decode command reply: %w", err)
+	}
+
+	dispatcher.mutex.Lock()
+	replies, ok := dispatcher.pending[reply.Id]
+	dispatcher.mutex.Unlock()
+
+	if !ok {
+		log.FromContext(ctx).Warnw("Dropping reply of remote command that nobody is waiting for",
+			"id", reply.Id,
+			"correlation-id", reply.CorrelationId)
+
+		return nil
+	}
+
+	select {
+	case replies <- reply:
+	default:
+		// a reply was already delivered for this id
+	}
+
+	return nil
+}
+
+func (dispatcher *Dispatcher) publish(ctx context.Context, envelope Envelope) error {
+	msg, err := newEnvelopeMessage(dispatcher.destination, envelope)
+	if err != nil {
+		return err
+	}
+
+	return dispatcher.publisher.Publish(ctx, msg)
+}
+
+// Request executes the command remotely with the Dispatcher and decodes the JSON result into R, whether or
+// not a result type is registered for the command with Expect.
+func Request[R any](ctx context.Context, dispatcher *Dispatcher, command commander.Command) (R, error) {
+	var result R
+
+	raw, err := dispatcher.request(ctx, command)
+	if err != nil {
+		return result, err
+	}
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return result, fmt.Errorf("could not decode result of remote command %s: %w", command.Key(), err)
+		}
+	}
+
+	return result, nil
+}
+
+// newEnvelope wraps the command in an envelope, signed and with the claims of the caller if the dispatcher
+// has a signing key.
+func (dispatcher *Dispatcher) newEnvelope(ctx context.Context, command commander.Command, replyTo string) (Envelope, error) {
+	payload, err := json.Marshal(command)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("could not encode command %s: %w", command.Key(), err)
+	}
+
+	id, err := shortid.Generate()
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	envelope := Envelope{
+		Id:            id,
+		Key:           command.Key(),
+		Payload:       payload,
+		CorrelationId: correlation.FromContext(ctx),
+		ReplyTo:       replyTo,
+		IssuedAt:      time.Now().UnixMilli(),
+	}
+
+	if dispatcher.signingKey == nil {
+		return envelope, nil
+	}
+
+	if claims := jwtverifier.ClaimsFromContext(ctx); claims != nil {
+		envelope.Claims, err = json.Marshal(claims)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("could not encode the claims of the caller: %w", err)
+		}
+	}
+
+	envelope.Signature = envelope.sign(dispatcher.signingKey)
+
+	return envelope, nil
+}
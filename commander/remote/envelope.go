@@ -0,0 +1,161 @@
+// Package remote sends commander commands to other services through the message broker and executes
+// the commands received from other services with a local commander.Executor.
+package remote
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/brokerclient"
+)
+
+const (
+	// MessageTypeCommandPrefix prefixes the command key in the message type header of a command envelope.
+	MessageTypeCommandPrefix = "command."
+
+	// MessageTypeReply is the message type header of a reply envelope.
+	MessageTypeReply = "command.reply"
+)
+
+const (
+	// ErrorCodeInvalid is the code of a reply to a command that failed validation or couldn't be decoded.
+	ErrorCodeInvalid = "invalid"
+
+	// ErrorCodeForbidden is the code of a reply to a command that the caller isn't allowed to execute.
+	ErrorCodeForbidden = "forbidden"
+
+	// ErrorCodeUnsupported is the code of a reply to a command that the receiving service doesn't handle.
+	ErrorCodeUnsupported = "unsupported"
+
+	// ErrorCodeInternal is the code of a reply to a command that failed for any other reason. The error
+	// itself is only logged by the receiving service, with the error id given in the message.
+	ErrorCodeInternal = "internal"
+)
+
+// Envelope carries a command to another service.
+type Envelope struct {
+	// Id identifies the envelope. The reply to the envelope carries the same id.
+	Id string `json:"id"`
+
+	// Key is the commander.Command key used to decode the payload.
+	Key string `json:"key"`
+
+	// Payload is the JSON encoded command.
+	Payload json.RawMessage `json:"payload"`
+
+	// CorrelationId is the correlation id of the sender.
+	CorrelationId string `json:"cid"`
+
+	// ReplyTo is the destination that the reply should be published to. It is empty if the sender
+	// doesn't expect a reply.
+	ReplyTo string `json:"replyTo,omitempty"`
+
+	// IssuedAt is when the envelope was created, in milliseconds since the Unix epoch. A Consumer with a signing
+	// key rejects envelopes that are older than its maximum age, see WithMaxAge.
+	IssuedAt int64 `json:"iat,omitempty"`
+
+	// Claims are the JSON encoded claims of the caller. They are only sent by a Dispatcher with a signing
+	// key and only trusted by a Consumer with the same key.
+	Claims json.RawMessage `json:"claims,omitempty"`
+
+	// Signature is the HMAC-SHA256 of the other fields with the signing key of the sender, if any.
+	Signature []byte `json:"sig,omitempty"`
+}
+
+// sign returns the HMAC-SHA256 of the fields of the envelope, other than the signature, with the key.
+func (envelope Envelope) sign(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+
+	fields := [][]byte{
+		[]byte(envelope.Id),
+		[]byte(envelope.Key),
+		envelope.Payload,
+		[]byte(envelope.CorrelationId),
+		[]byte(envelope.ReplyTo),
+		[]byte(strconv.FormatInt(envelope.IssuedAt, 10)),
+		envelope.Claims,
+	}
+
+	for _, field := range fields {
+		_ = binary.Write(mac, binary.BigEndian, uint64(len(field)))
+		mac.Write(field)
+	}
+
+	return mac.Sum(nil)
+}
+
+// verify reports whether the envelope is signed with the key.
+func (envelope Envelope) verify(key []byte) bool {
+	return len(envelope.Signature) > 0 && hmac.Equal(envelope.Signature, envelope.sign(key))
+}
+
+// age returns how long ago the envelope was created.
+func (envelope Envelope) age(now time.Time) time.Duration {
+	return now.Sub(time.UnixMilli(envelope.IssuedAt))
+}
+
+// Reply carries the outcome of a command back to the sender.
+type Reply struct {
+	// Id is the id of the Envelope that this is a reply to.
+	Id string `json:"id"`
+
+	// CorrelationId is the correlation id of the sender.
+	CorrelationId string `json:"cid"`
+
+	// Result is the JSON encoded result of the command. It is empty if the command failed.
+	Result json.RawMessage `json:"result,omitempty"`
+
+	// Error is the error message of the command. It is empty if the command succeeded.
+	Error string `json:"error,omitempty"`
+
+	// Code classifies the error, e.g. ErrorCodeInvalid. It is empty if the command succeeded.
+	Code string `json:"code,omitempty"`
+}
+
+// RemoteError is returned to the sender when the command failed on the receiving side. Code is one of the
+// ErrorCode constants. Only the messages of validation, authorization and unsupported command errors are
+// sent back, other errors are replaced with an error id that can be looked up in the receiver's logs.
+type RemoteError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote command %s failed: %s", e.Key, e.Message)
+}
+
+func newEnvelopeMessage(destination string, envelope Envelope) (*brokerclient.BrokerMessage, error) {
+	content, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &brokerclient.BrokerMessage{
+		Destination: destination,
+		Headers: map[string][]byte{
+			brokerclient.HeaderMessageType: []byte(MessageTypeCommandPrefix + envelope.Key),
+		},
+		Content: content,
+	}, nil
+}
+
+func newReplyMessage(destination string, reply Reply) (*brokerclient.BrokerMessage, error) {
+	content, err := json.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return &brokerclient.BrokerMessage{
+		Destination: destination,
+		Headers: map[string][]byte{
+			brokerclient.HeaderMessageType: []byte(MessageTypeReply),
+		},
+		Content: content,
+	}, nil
+}
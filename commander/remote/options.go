@@ -0,0 +1,43 @@
+package remote
+
+import "time"
+
+// defaultMaxAge is how long a Consumer with a signing key accepts an envelope after it was created.
+const defaultMaxAge = 5 * time.Minute
+
+// Option configures a Dispatcher or a Consumer.
+type Option func(*options)
+
+type options struct {
+	signingKey []byte
+	maxAge     time.Duration
+}
+
+// WithSigningKey makes a Dispatcher sign the envelopes with the key and send the claims of the caller, from
+// jwtverifier.ClaimsFromContext, along with the commands. It makes a Consumer only accept envelopes signed with
+// the key by a Dispatcher with the same key, and execute their commands with the claims of the caller sent in
+// the envelope. Envelopes that aren't signed with the key fail with a *commander.ForbiddenError.
+func WithSigningKey(key []byte) Option {
+	return func(options *options) {
+		options.signingKey = key
+	}
+}
+
+// WithMaxAge sets how long a Consumer with a signing key accepts an envelope after it was created, 5 minutes by
+// default. Older envelopes, and envelopes created that long in the future, fail with a *commander.ForbiddenError
+// so that a captured envelope can't be replayed later. It must cover the clock skew between the services and
+// how long the envelopes can wait in the broker.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(options *options) {
+		options.maxAge = maxAge
+	}
+}
+
+func newOptions(opts []Option) *options {
+	options := &options{maxAge: defaultMaxAge}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return options
+}
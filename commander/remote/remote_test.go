@@ -0,0 +1,233 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander/remote/remotetest"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/correlation"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/jwtverifier"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+type createClient struct {
+	TenantId string `json:"tenantId"`
+	Name     string `json:"name"`
+}
+
+func (c *createClient) Key() string {
+	return "CreateClient"
+}
+
+func (c *createClient) RequiredScopes() []string {
+	return []string{"id.clients:write"}
+}
+
+type client struct {
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	CorrelationId string `json:"cid"`
+	CreatedBy     string `json:"createdBy"`
+}
+
+// handleEnvelope delivers the envelope to a consumer created with the options and returns its reply.
+func handleEnvelope(t *testing.T, ctx context.Context, executor commander.Executor, envelope Envelope, opts ...Option) Reply {
+	replies := remotetest.NewInMemoryBroker()
+	consumer := NewConsumer(executor, replies, opts...)
+	Accept[*createClient](consumer)
+
+	return deliver(t, ctx, consumer, replies, envelope)
+}
+
+// deliver delivers the envelope to the consumer and returns the reply it published to replies.
+func deliver(t *testing.T, ctx context.Context, consumer *Consumer, replies *remotetest.InMemoryBroker, envelope Envelope) Reply {
+	msg, err := newEnvelopeMessage("clients.commands", envelope)
+	require.NoError(t, err)
+	require.NoError(t, consumer.Handle(ctx, msg))
+
+	published := replies.Published()
+	require.NotEmpty(t, published)
+
+	var reply Reply
+	require.NoError(t, json.Unmarshal(published[len(published)-1].Content, &reply))
+
+	return reply
+}
+
+func TestRemoteDispatch(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	var received []*createClient
+	handler := commander.HandlerFunc(func(ctx context.Context, command commander.Command) (any, error) {
+		create := command.(*createClient)
+		received = append(received, create)
+
+		switch create.Name {
+		case "":
+			return nil, commander.NewValidationError(command.Key(), commander.FieldError{Field: "name", Message: "is required"})
+		case "db":
+			return nil, errors.New("insert into clients at db-1.internal failed")
+		}
+
+		createdBy, _ := jwtverifier.ClaimsFromContext(ctx)[commander.SubjectClaim].(string)
+
+		return &client{Id: "c-1", Name: create.Name, CorrelationId: correlation.FromContext(ctx), CreatedBy: createdBy}, nil
+	})
+
+	key := []byte("shared-signing-key")
+	broker := remotetest.NewInMemoryBroker()
+
+	cmdr := commander.Commander{}.
+		WithHandler(handler, &createClient{}).
+		WithBehaviors(commander.AuthorizationBehavior())
+
+	consumer := NewConsumer(cmdr, broker, WithSigningKey(key))
+	Accept[*createClient](consumer)
+	broker.Subscribe("clients.commands", consumer.Handle)
+
+	dispatcher := NewDispatcher(broker, "clients.commands", "tenants.replies", WithSigningKey(key))
+	Expect[*createClient, *client](dispatcher)
+	broker.Subscribe("tenants.replies", dispatcher.HandleReply)
+
+	ctx := correlation.NewContext(context.Background(), "cid-1")
+	ctx = jwtverifier.NewContext(ctx, map[string]any{commander.SubjectClaim: "jane", commander.ScopeClaim: "id.clients:write"})
+
+	t.Run("should execute the command remotely as the caller and return the reply", func(t *testing.T) {
+		result, err := Request[*client](ctx, dispatcher, &createClient{TenantId: "t-1", Name: "portal"})
+
+		require.NoError(t, err)
+		assert.Equal(t, &client{Id: "c-1", Name: "portal", CorrelationId: "cid-1", CreatedBy: "jane"}, result)
+	})
+
+	t.Run("should be usable as a commander.Executor", func(t *testing.T) {
+		result, err := commander.Send[*client](ctx, dispatcher, &createClient{TenantId: "t-1", Name: "portal"})
+
+		require.NoError(t, err)
+		assert.Equal(t, &client{Id: "c-1", Name: "portal", CorrelationId: "cid-1", CreatedBy: "jane"}, result)
+	})
+
+	t.Run("should fail to execute commands without a result type", func(t *testing.T) {
+		dispatcher := NewDispatcher(broker, "clients.commands", "tenants.replies", WithSigningKey(key))
+		broker.Subscribe("tenants.replies", dispatcher.HandleReply)
+
+		_, err := dispatcher.Execute(ctx, &createClient{TenantId: "t-1", Name: "portal"})
+
+		assert.ErrorContains(t, err, "no result type is registered for remote command CreateClient")
+	})
+
+	t.Run("should return the remote validation error", func(t *testing.T) {
+		_, err := Request[*client](ctx, dispatcher, &createClient{TenantId: "t-1"})
+
+		var remoteErr *RemoteError
+		require.ErrorAs(t, err, &remoteErr)
+		assert.Equal(t, ErrorCodeInvalid, remoteErr.Code)
+		assert.Contains(t, remoteErr.Message, "name: is required")
+	})
+
+	t.Run("should not return the message of internal errors", func(t *testing.T) {
+		_, err := Request[*client](ctx, dispatcher, &createClient{TenantId: "t-1", Name: "db"})
+
+		var remoteErr *RemoteError
+		require.ErrorAs(t, err, &remoteErr)
+		assert.Equal(t, ErrorCodeInternal, remoteErr.Code)
+		assert.Contains(t, remoteErr.Message, "errorId")
+		assert.NotContains(t, remoteErr.Message, "db-1.internal")
+	})
+
+	t.Run("should authorize the command with the claims of the caller", func(t *testing.T) {
+		ctx := jwtverifier.NewContext(ctx, map[string]any{commander.SubjectClaim: "joe", commander.ScopeClaim: "id.clients:read"})
+
+		_, err := Request[*client](ctx, dispatcher, &createClient{TenantId: "t-1", Name: "portal"})
+
+		var remoteErr *RemoteError
+		require.ErrorAs(t, err, &remoteErr)
+		assert.Equal(t, ErrorCodeForbidden, remoteErr.Code)
+	})
+
+	t.Run("should reject envelopes that aren't signed with the key", func(t *testing.T) {
+		for _, signingKey := range [][]byte{nil, []byte("other-key")} {
+			dispatcher := NewDispatcher(broker, "clients.commands", "tenants.replies", WithSigningKey(signingKey))
+			broker.Subscribe("tenants.replies", dispatcher.HandleReply)
+			received = nil
+
+			_, err := Request[*client](ctx, dispatcher, &createClient{TenantId: "t-1", Name: "portal"})
+
+			var remoteErr *RemoteError
+			require.ErrorAs(t, err, &remoteErr)
+			assert.Equal(t, ErrorCodeForbidden, remoteErr.Code)
+			assert.Empty(t, received)
+		}
+	})
+
+	t.Run("should reject a replayed envelope", func(t *testing.T) {
+		replies := remotetest.NewInMemoryBroker()
+		consumer := NewConsumer(cmdr, replies, WithSigningKey(key))
+		Accept[*createClient](consumer)
+
+		envelope, err := dispatcher.newEnvelope(ctx, &createClient{TenantId: "t-1", Name: "portal"}, "tenants.replies")
+		require.NoError(t, err)
+
+		assert.Empty(t, deliver(t, context.Background(), consumer, replies, envelope).Error)
+
+		reply := deliver(t, context.Background(), consumer, replies, envelope)
+		assert.Equal(t, ErrorCodeForbidden, reply.Code)
+		assert.Contains(t, reply.Error, "the command was already received")
+	})
+
+	t.Run("should reject stale envelopes and expired claims", func(t *testing.T) {
+		received = nil
+
+		stale := Envelope{Id: "e-1", Key: "CreateClient", Payload: []byte(`{"name":"portal"}`), ReplyTo: "tenants.replies", IssuedAt: time.Now().Add(-time.Hour).UnixMilli()}
+		stale.Signature = stale.sign(key)
+
+		expired := Envelope{Id: "e-2", Key: "CreateClient", Payload: []byte(`{"name":"portal"}`), ReplyTo: "tenants.replies", IssuedAt: time.Now().UnixMilli()}
+		expired.Claims = []byte(fmt.Sprintf(`{"sub":"jane","scope":"id.clients:write","exp":%d}`, time.Now().Add(-time.Minute).Unix()))
+		expired.Signature = expired.sign(key)
+
+		reply := handleEnvelope(t, context.Background(), cmdr, stale, WithSigningKey(key))
+		assert.Equal(t, ErrorCodeForbidden, reply.Code)
+		assert.Contains(t, reply.Error, "the command is too old")
+
+		reply = handleEnvelope(t, context.Background(), cmdr, expired, WithSigningKey(key))
+		assert.Equal(t, ErrorCodeForbidden, reply.Code)
+		assert.Contains(t, reply.Error, "the claims of the caller are expired")
+
+		assert.Empty(t, received)
+	})
+
+	t.Run("should not execute commands without claims as the service", func(t *testing.T) {
+		received = nil
+		serviceCtx := commander.NewServiceIdentityContext(context.Background(), commander.ServiceIdentity{Name: "clients", Scopes: []string{"id.clients:write"}})
+
+		unsigned := Envelope{Id: "e-3", Key: "CreateClient", Payload: []byte(`{"name":"portal"}`), ReplyTo: "tenants.replies"}
+
+		signed := Envelope{Id: "e-4", Key: "CreateClient", Payload: []byte(`{"name":"portal"}`), ReplyTo: "tenants.replies", IssuedAt: time.Now().UnixMilli()}
+		signed.Signature = signed.sign(key)
+
+		reply := handleEnvelope(t, serviceCtx, cmdr, unsigned)
+		assert.Equal(t, ErrorCodeForbidden, reply.Code)
+
+		reply = handleEnvelope(t, serviceCtx, cmdr, signed, WithSigningKey(key))
+		assert.Equal(t, ErrorCodeForbidden, reply.Code)
+
+		assert.Empty(t, received)
+	})
+
+	t.Run("should send the command without waiting for a reply", func(t *testing.T) {
+		received = nil
+		published := len(broker.Published())
+
+		err := dispatcher.Send(ctx, &createClient{TenantId: "t-2", Name: "admin"})
+
+		require.NoError(t, err)
+		assert.Equal(t, []*createClient{{TenantId: "t-2", Name: "admin"}}, received)
+		assert.Len(t, broker.Published(), published+1)
+	})
+}
@@ -0,0 +1,64 @@
+// Package remotetest provides an in-memory stand-in for the message broker, so that the commander/remote
+// Dispatcher and Consumer can be tested without a network.
+package remotetest
+
+import (
+	"context"
+	"sync"
+
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/brokerclient"
+)
+
+// MessageHandler handles a message delivered from a destination. remote.Consumer.Handle and
+// remote.Dispatcher.HandleReply are MessageHandlers.
+type MessageHandler func(ctx context.Context, msg *brokerclient.BrokerMessage) error
+
+// InMemoryBroker is a brokerclient.Publisher that delivers the published messages synchronously to the
+// handlers subscribed to their destination. It is meant to be used in tests in place of the message broker.
+type InMemoryBroker struct {
+	mutex       sync.Mutex
+	subscribers map[string][]MessageHandler
+	published   []*brokerclient.BrokerMessage
+}
+
+var _ brokerclient.Publisher = &InMemoryBroker{}
+
+// NewInMemoryBroker creates an InMemoryBroker without subscribers.
+func NewInMemoryBroker() *InMemoryBroker {
+	return &InMemoryBroker{
+		subscribers: map[string][]MessageHandler{},
+	}
+}
+
+// Subscribe delivers the messages published to destination to the handler.
+func (broker *InMemoryBroker) Subscribe(destination string, handler MessageHandler) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	broker.subscribers[destination] = append(broker.subscribers[destination], handler)
+}
+
+// Publish records the message and delivers it to the subscribers of its destination. The first error
+// returned by a subscriber is returned.
+func (broker *InMemoryBroker) Publish(ctx context.Context, msg *brokerclient.BrokerMessage) error {
+	broker.mutex.Lock()
+	broker.published = append(broker.published, msg)
+	subscribers := append([]MessageHandler{}, broker.subscribers[msg.Destination]...)
+	broker.mutex.Unlock()
+
+	for _, subscriber := range subscribers {
+		if err := subscriber(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Published returns all the messages published so far.
+func (broker *InMemoryBroker) Published() []*brokerclient.BrokerMessage {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	return append([]*brokerclient.BrokerMessage{}, broker.published...)
+}
@@ -0,0 +1,51 @@
+package saga
+
+// The audit events published by a Saga. The type name of each event is used as the audit event type.
+
+type SagaStarted struct {
+	SagaId string `json:"sagaId"`
+	Saga   string `json:"saga"`
+}
+
+type SagaStepCompleted struct {
+	SagaId string `json:"sagaId"`
+	Saga   string `json:"saga"`
+	Step   string `json:"step"`
+}
+
+// SagaStepFailed is published when the forward command of a step fails. Reason classifies the error, e.g.
+// commander.OutcomeInvalid, without its message, which is only logged.
+type SagaStepFailed struct {
+	SagaId string `json:"sagaId"`
+	Saga   string `json:"saga"`
+	Step   string `json:"step"`
+	Reason string `json:"reason"`
+}
+
+type SagaStepCompensated struct {
+	SagaId string `json:"sagaId"`
+	Saga   string `json:"saga"`
+	Step   string `json:"step"`
+}
+
+// SagaStepCompensationFailed is published when the compensating command of a step fails. Reason classifies
+// the error like in SagaStepFailed.
+type SagaStepCompensationFailed struct {
+	SagaId string `json:"sagaId"`
+	Saga   string `json:"saga"`
+	Step   string `json:"step"`
+	Reason string `json:"reason"`
+}
+
+type SagaCompleted struct {
+	SagaId string `json:"sagaId"`
+	Saga   string `json:"saga"`
+}
+
+// SagaFailed is published after the compensations have run. Compensated is false if any of them failed.
+type SagaFailed struct {
+	SagaId      string `json:"sagaId"`
+	Saga        string `json:"saga"`
+	Step        string `json:"step"`
+	Compensated bool   `json:"compensated"`
+}
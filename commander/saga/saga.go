@@ -0,0 +1,218 @@
+// Package saga orchestrates multi-step workflows on top of a commander.Executor. Each step executes a
+// forward command and, if a later step fails, a compensating command that undoes it.
+package saga
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/teris-io/shortid"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/auditeventspublisher"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+// Results holds the results of the forward commands of the steps that completed so far, keyed by step name.
+type Results map[string]any
+
+// CommandFactory creates the command of a step. It receives the results of the previous steps so that
+// a command can use e.g. the id of a resource created earlier.
+type CommandFactory func(ctx context.Context, results Results) (commander.Command, error)
+
+// Command returns a CommandFactory that always returns the given command.
+func Command(command commander.Command) CommandFactory {
+	return func(ctx context.Context, results Results) (commander.Command, error) {
+		return command, nil
+	}
+}
+
+// Step is a single step of a Saga. Compensate is optional and is only run if the Forward command
+// succeeded and a later step failed. When Compensate runs, the results include the result of
+// this step's Forward command.
+type Step struct {
+	Name       string
+	Forward    CommandFactory
+	Compensate CommandFactory
+}
+
+type StepStatus string
+
+const (
+	StepPending            StepStatus = "pending"
+	StepCompleted          StepStatus = "completed"
+	StepFailed             StepStatus = "failed"
+	StepCompensated        StepStatus = "compensated"
+	StepCompensationFailed StepStatus = "compensation-failed"
+)
+
+// StepOutcome records what happened to a step during a run.
+type StepOutcome struct {
+	Name            string
+	Status          StepStatus
+	Result          any
+	Err             error
+	CompensationErr error
+}
+
+// Outcome records what happened to each step during a run.
+type Outcome struct {
+	SagaId    string
+	Saga      string
+	Steps     []StepOutcome
+	Completed bool
+}
+
+// Error is returned by Saga.Run when a step fails. CompensationErrs holds the errors of the compensations
+// that failed as well, if any.
+type Error struct {
+	Saga             string
+	Step             string
+	Err              error
+	CompensationErrs []error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("saga %s failed at step %s: %v", e.Saga, e.Step, e.Err)
+
+	if len(e.CompensationErrs) > 0 {
+		compensationMsgs := make([]string, 0, len(e.CompensationErrs))
+		for _, err := range e.CompensationErrs {
+			compensationMsgs = append(compensationMsgs, err.Error())
+		}
+
+		msg = fmt.Sprintf("%s; compensation failed: %s", msg, strings.Join(compensationMsgs, "; "))
+	}
+
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Saga executes its steps in order with a commander.Executor. A Saga holds no run state and can be run
+// concurrently.
+type Saga struct {
+	name     string
+	executor commander.Executor
+	steps    []Step
+}
+
+// New creates a Saga with the given name that executes the steps with executor.
+func New(name string, executor commander.Executor, steps ...Step) *Saga {
+	return &Saga{
+		name:     name,
+		executor: executor,
+		steps:    steps,
+	}
+}
+
+// Run executes the forward command of each step in order. If a step fails, the compensating commands
+// of the steps that completed before it are executed in reverse order and an *Error is returned.
+// Compensations run even if ctx was cancelled. Audit events about the progress of the saga are
+// published with the AuditEventsPublisher from the context or, if the saga runs inside a command handler,
+// raised with commander.RaiseEvent so that they are only published if the command succeeds.
+func (saga *Saga) Run(ctx context.Context) (*Outcome, error) {
+	sagaId, _ := shortid.Generate()
+	logger := log.FromContext(ctx).With("saga", saga.name, "sagaId", sagaId)
+	ctx = log.NewContext(ctx, logger)
+
+	outcome := &Outcome{
+		SagaId: sagaId,
+		Saga:   saga.name,
+		Steps:  make([]StepOutcome, len(saga.steps)),
+	}
+
+	for i, step := range saga.steps {
+		outcome.Steps[i] = StepOutcome{Name: step.Name, Status: StepPending}
+	}
+
+	saga.publish(ctx, &SagaStarted{SagaId: sagaId, Saga: saga.name})
+
+	results := Results{}
+
+	for i, step := range saga.steps {
+		result, err := saga.execute(ctx, step.Forward, results)
+		if err != nil {
+			logger.Warnw(fmt.Sprintf("Saga step %s failed -- compensating", step.Name), "error", err)
+
+			outcome.Steps[i].Status = StepFailed
+			outcome.Steps[i].Err = err
+			saga.publish(ctx, &SagaStepFailed{SagaId: sagaId, Saga: saga.name, Step: step.Name, Reason: commander.CommandOutcome(err)})
+
+			compensationErrs := saga.compensate(context.WithoutCancel(ctx), outcome, i, results)
+
+			saga.publish(ctx, &SagaFailed{SagaId: sagaId, Saga: saga.name, Step: step.Name, Compensated: len(compensationErrs) == 0})
+
+			return outcome, &Error{
+				Saga:             saga.name,
+				Step:             step.Name,
+				Err:              err,
+				CompensationErrs: compensationErrs,
+			}
+		}
+
+		results[step.Name] = result
+		outcome.Steps[i].Status = StepCompleted
+		outcome.Steps[i].Result = result
+		saga.publish(ctx, &SagaStepCompleted{SagaId: sagaId, Saga: saga.name, Step: step.Name})
+	}
+
+	outcome.Completed = true
+	saga.publish(ctx, &SagaCompleted{SagaId: sagaId, Saga: saga.name})
+
+	return outcome, nil
+}
+
+// compensate runs the compensations of the steps before failedStep in reverse order. It doesn't stop at
+// the first failed compensation so that as much as possible is undone.
+func (saga *Saga) compensate(ctx context.Context, outcome *Outcome, failedStep int, results Results) []error {
+	var compensationErrs []error
+
+	for i := failedStep - 1; i >= 0; i-- {
+		step := saga.steps[i]
+		if step.Compensate == nil {
+			continue
+		}
+
+		_, err := saga.execute(ctx, step.Compensate, results)
+		if err != nil {
+			log.FromContext(ctx).Errorw(fmt.Sprintf("Saga step %s could not be compensated", step.Name), "error", err)
+
+			outcome.Steps[i].Status = StepCompensationFailed
+			outcome.Steps[i].CompensationErr = err
+			compensationErrs = append(compensationErrs, fmt.Errorf("step %s: %w", step.Name, err))
+			saga.publish(ctx, &SagaStepCompensationFailed{SagaId: outcome.SagaId, Saga: saga.name, Step: step.Name, Reason: commander.CommandOutcome(err)})
+
+			continue
+		}
+
+		outcome.Steps[i].Status = StepCompensated
+		saga.publish(ctx, &SagaStepCompensated{SagaId: outcome.SagaId, Saga: saga.name, Step: step.Name})
+	}
+
+	return compensationErrs
+}
+
+func (saga *Saga) execute(ctx context.Context, factory CommandFactory, results Results) (any, error) {
+	command, err := factory(ctx, results)
+	if err != nil {
+		return nil, err
+	}
+
+	return saga.executor.Execute(ctx, command)
+}
+
+// publish raises the audit event with the command being handled with ctx, if any, or else publishes it.
+// Failing to publish doesn't fail the saga.
+func (saga *Saga) publish(ctx context.Context, event any) {
+	if commander.EventCollectorFromContext(ctx) != nil {
+		commander.RaiseEvent(ctx, event)
+		return
+	}
+
+	if err := auditeventspublisher.FromContext(ctx).Publish(ctx, event); err != nil {
+		log.FromContext(ctx).Warnw("Failed to publish saga audit event", "event", fmt.Sprintf("%T", event), "error", err)
+	}
+}
@@ -0,0 +1,155 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/auditeventspublisher"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+type testCommand struct {
+	Name string
+}
+
+func (c testCommand) Key() string {
+	return "Test"
+}
+
+type recordingPublisher struct {
+	events    []string
+	published []any
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event any) error {
+	p.events = append(p.events, fmt.Sprintf("%T", event))
+	p.published = append(p.published, event)
+	return nil
+}
+
+type provision struct {
+	Fail bool
+}
+
+func (c provision) Key() string {
+	return "Provision"
+}
+
+func TestSaga(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	var executed []string
+	handler := commander.HandlerFunc(func(ctx context.Context, command commander.Command) (any, error) {
+		name := command.(testCommand).Name
+		executed = append(executed, name)
+
+		if name == "grant scopes" {
+			return nil, errors.New("scope not found")
+		}
+
+		return name + " result", nil
+	})
+
+	cmdr := commander.Commander{}.WithHandler(handler, testCommand{})
+
+	steps := []Step{
+		{
+			Name:       "tenant",
+			Forward:    Command(testCommand{Name: "create tenant"}),
+			Compensate: Command(testCommand{Name: "delete tenant"}),
+		},
+		{
+			Name:    "client",
+			Forward: Command(testCommand{Name: "create client"}),
+			Compensate: func(ctx context.Context, results Results) (commander.Command, error) {
+				return testCommand{Name: "delete " + results["client"].(string)}, nil
+			},
+		},
+	}
+
+	t.Run("should complete all the steps", func(t *testing.T) {
+		executed = nil
+		publisher := &recordingPublisher{}
+		ctx := auditeventspublisher.NewContext(context.Background(), publisher)
+
+		outcome, err := New("provision", cmdr, steps...).Run(ctx)
+
+		require.NoError(t, err)
+		assert.True(t, outcome.Completed)
+		assert.Equal(t, []string{"create tenant", "create client"}, executed)
+		assert.Equal(t, []string{
+			"*saga.SagaStarted",
+			"*saga.SagaStepCompleted",
+			"*saga.SagaStepCompleted",
+			"*saga.SagaCompleted",
+		}, publisher.events)
+	})
+
+	t.Run("should compensate in reverse order when a step fails", func(t *testing.T) {
+		executed = nil
+		publisher := &recordingPublisher{}
+		ctx := auditeventspublisher.NewContext(context.Background(), publisher)
+
+		failing := append(steps, Step{Name: "scopes", Forward: Command(testCommand{Name: "grant scopes"})})
+
+		outcome, err := New("provision", cmdr, failing...).Run(ctx)
+
+		var sagaErr *Error
+		require.ErrorAs(t, err, &sagaErr)
+		assert.Equal(t, "scopes", sagaErr.Step)
+		assert.Empty(t, sagaErr.CompensationErrs)
+
+		assert.False(t, outcome.Completed)
+		assert.Equal(t, []string{"create tenant", "create client", "grant scopes", "delete create client result", "delete tenant"}, executed)
+		assert.Equal(t, []StepStatus{StepCompensated, StepCompensated, StepFailed}, []StepStatus{
+			outcome.Steps[0].Status,
+			outcome.Steps[1].Status,
+			outcome.Steps[2].Status,
+		})
+		assert.Equal(t, []string{
+			"*saga.SagaStarted",
+			"*saga.SagaStepCompleted",
+			"*saga.SagaStepCompleted",
+			"*saga.SagaStepFailed",
+			"*saga.SagaStepCompensated",
+			"*saga.SagaStepCompensated",
+			"*saga.SagaFailed",
+		}, publisher.events)
+		assert.Equal(t, commander.OutcomeError, publisher.published[3].(*SagaStepFailed).Reason)
+	})
+
+	t.Run("should only publish the events once the command running the saga succeeds", func(t *testing.T) {
+		outer := cmdr.WithHandler(commander.HandlerFunc(func(ctx context.Context, command commander.Command) (any, error) {
+			if _, err := New("provision", cmdr, steps...).Run(ctx); err != nil {
+				return nil, err
+			}
+
+			if command.(provision).Fail {
+				return nil, errors.New("could not provision")
+			}
+
+			return nil, nil
+		}), provision{})
+
+		publisher := &recordingPublisher{}
+		ctx := auditeventspublisher.NewContext(context.Background(), publisher)
+
+		_, err := outer.Execute(ctx, provision{Fail: true})
+		require.Error(t, err)
+		assert.Empty(t, publisher.events)
+
+		_, err = outer.Execute(ctx, provision{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"*saga.SagaStarted",
+			"*saga.SagaStepCompleted",
+			"*saga.SagaStepCompleted",
+			"*saga.SagaCompleted",
+		}, publisher.events)
+	})
+}
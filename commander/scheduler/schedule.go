@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule returns the next time a recurring job runs after the given time.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (schedule everySchedule) Next(t time.Time) time.Time {
+	return t.Add(schedule.interval)
+}
+
+// Every returns a Schedule that runs at a fixed interval. It returns an error if the interval isn't positive.
+func Every(interval time.Duration) (Schedule, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("the interval %s must be positive", interval)
+	}
+
+	return everySchedule{interval: interval}, nil
+}
+
+// nextRun returns the next time of the schedule after the given time. It returns an error if the schedule
+// has no next time, such as a cron expression that never matches, or if it doesn't move forward.
+func nextRun(schedule Schedule, after time.Time) (time.Time, error) {
+	next := schedule.Next(after)
+
+	if next.IsZero() {
+		return time.Time{}, errors.New("the schedule has no next run")
+	}
+
+	if !next.After(after) {
+		return time.Time{}, fmt.Errorf("the next run of the schedule at %s is not after %s", next, after)
+	}
+
+	return next, nil
+}
+
+// ParseSchedule parses either an interval, such as "5m" or "1h30m", or a standard 5-field cron expression,
+// such as "0 3 * * *", including descriptors like "@daily" and "@every 5m". Cron expressions are
+// evaluated in the local time zone unless they start with "CRON_TZ=".
+func ParseSchedule(spec string) (Schedule, error) {
+	if interval, err := time.ParseDuration(spec); err == nil {
+		schedule, err := Every(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+
+		return schedule, nil
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %q is neither an interval nor a cron expression: %w", spec, err)
+	}
+
+	return schedule, nil
+}
@@ -0,0 +1,302 @@
+// Package scheduler executes commander commands at a given time or on a recurring schedule.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/teris-io/shortid"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/correlation"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+	"go.uber.org/zap"
+)
+
+// ErrSchedulerClosed is returned when a command is scheduled after Scheduler.Shutdown was called.
+var ErrSchedulerClosed = errors.New("the scheduler is shut down")
+
+// CatchUpPolicy decides what a recurring job does when it missed one or more runs, e.g. because the
+// previous run took longer than the interval.
+type CatchUpPolicy int
+
+const (
+	// CatchUpSkip skips the missed runs and waits for the next scheduled time.
+	CatchUpSkip CatchUpPolicy = iota
+
+	// CatchUpOnce runs once right away for all the missed runs and then waits for the next scheduled time.
+	CatchUpOnce
+)
+
+// Option configures a Scheduler.
+type Option func(*Scheduler)
+
+// WithJitter delays each run by a random duration of up to jitter so that the replicas of a service
+// don't all run their jobs at the same time.
+func WithJitter(jitter time.Duration) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.jitter = jitter
+	}
+}
+
+// WithCatchUp sets the CatchUpPolicy of the recurring jobs. The default is CatchUpSkip.
+func WithCatchUp(policy CatchUpPolicy) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.catchUp = policy
+	}
+}
+
+type job struct {
+	id        string
+	ctx       context.Context
+	command   commander.Command
+	first     time.Time
+	schedule  Schedule
+	cancelled chan struct{}
+}
+
+// Scheduler executes commands with a commander.Executor at a given time or on a recurring schedule.
+// Each run gets a fresh correlation id and a logger tagged with it. The runs of a recurring job never overlap.
+type Scheduler struct {
+	executor commander.Executor
+	jitter   time.Duration
+	catchUp  CatchUpPolicy
+
+	mutex    sync.Mutex
+	jobs     map[string]*job
+	closed   bool
+	closing  chan struct{}
+	abort    context.Context
+	abortFn  context.CancelFunc
+	running  sync.WaitGroup
+	shutdown sync.Once
+}
+
+// New creates a Scheduler that executes the commands with executor.
+func New(executor commander.Executor, opts ...Option) *Scheduler {
+	abort, abortFn := context.WithCancel(context.Background())
+
+	scheduler := &Scheduler{
+		executor: executor,
+		jobs:     map[string]*job{},
+		closing:  make(chan struct{}),
+		abort:    abort,
+		abortFn:  abortFn,
+	}
+
+	for _, opt := range opts {
+		opt(scheduler)
+	}
+
+	return scheduler
+}
+
+// ScheduleAt executes the command once at the given time and returns the id of the job. The runs are
+// executed with the values of ctx, such as the logger, but not its cancellation.
+func (scheduler *Scheduler) ScheduleAt(ctx context.Context, at time.Time, command commander.Command) (string, error) {
+	return scheduler.add(ctx, command, at, nil)
+}
+
+// ScheduleEvery executes the command on the schedule described by spec and returns the id of the job.
+// See ParseSchedule for the format of spec. The runs are executed with the values of ctx, such as
+// the logger, but not its cancellation.
+func (scheduler *Scheduler) ScheduleEvery(ctx context.Context, spec string, command commander.Command) (string, error) {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return "", err
+	}
+
+	return scheduler.ScheduleOn(ctx, schedule, command)
+}
+
+// ScheduleOn executes the command on the given Schedule and returns the id of the job. It returns an error
+// if the schedule has no next run after now. A job whose schedule stops moving forward later on is cancelled.
+func (scheduler *Scheduler) ScheduleOn(ctx context.Context, schedule Schedule, command commander.Command) (string, error) {
+	first, err := nextRun(schedule, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("could not schedule command %s: %w", command.Key(), err)
+	}
+
+	return scheduler.add(ctx, command, first, schedule)
+}
+
+// Cancel stops the job with the given id. A run in progress is not interrupted. It returns false
+// if there is no such job.
+func (scheduler *Scheduler) Cancel(id string) bool {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	job, ok := scheduler.jobs[id]
+	if !ok {
+		return false
+	}
+
+	delete(scheduler.jobs, id)
+	close(job.cancelled)
+
+	return true
+}
+
+// Shutdown stops all the jobs and waits for the runs in progress to finish. If ctx is done before that,
+// the contexts of the runs in progress are cancelled and ctx.Err() is returned.
+func (scheduler *Scheduler) Shutdown(ctx context.Context) error {
+	scheduler.shutdown.Do(func() {
+		scheduler.mutex.Lock()
+		scheduler.closed = true
+		close(scheduler.closing)
+		scheduler.mutex.Unlock()
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		scheduler.running.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		scheduler.abortFn()
+		return nil
+	case <-ctx.Done():
+		scheduler.abortFn()
+		return ctx.Err()
+	}
+}
+
+func (scheduler *Scheduler) add(ctx context.Context, command commander.Command, first time.Time, schedule Schedule) (string, error) {
+	id, err := shortid.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	job := &job{
+		id:        id,
+		ctx:       context.WithoutCancel(ctx),
+		command:   command,
+		first:     first,
+		schedule:  schedule,
+		cancelled: make(chan struct{}),
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if scheduler.closed {
+		return "", ErrSchedulerClosed
+	}
+
+	scheduler.jobs[id] = job
+	scheduler.running.Add(1)
+
+	go scheduler.loop(job)
+
+	return id, nil
+}
+
+func (scheduler *Scheduler) loop(job *job) {
+	defer scheduler.running.Done()
+
+	logger := log.FromContext(job.ctx).With("job", job.id, "command", job.command.Key())
+	next := job.first
+
+	for {
+		timer := time.NewTimer(time.Until(next) + scheduler.randomJitter())
+
+		select {
+		case <-timer.C:
+		case <-job.cancelled:
+			timer.Stop()
+			return
+		case <-scheduler.closing:
+			timer.Stop()
+			return
+		}
+
+		scheduler.run(job)
+
+		if job.schedule == nil {
+			scheduler.Cancel(job.id)
+			return
+		}
+
+		var err error
+		if next, err = scheduler.next(job, next, logger); err != nil {
+			logger.Errorw("Scheduled job has no next run -- cancelling it", "error", err)
+			scheduler.Cancel(job.id)
+			return
+		}
+	}
+}
+
+// next returns the time of the run of the job after the one scheduled at previous, applying the CatchUpPolicy
+// if that time has already passed.
+func (scheduler *Scheduler) next(job *job, previous time.Time, logger *zap.SugaredLogger) (time.Time, error) {
+	next, err := nextRun(job.schedule, previous)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	if !next.Before(now) {
+		return next, nil
+	}
+
+	switch scheduler.catchUp {
+	case CatchUpOnce:
+		logger.Warnw("Scheduled job missed one or more runs -- running once to catch up", "missedRun", next)
+		return now, nil
+	default:
+		logger.Warnw("Scheduled job missed one or more runs -- skipping them", "missedRun", next)
+		return nextRun(job.schedule, now)
+	}
+}
+
+func (scheduler *Scheduler) run(job *job) {
+	correlationId, _ := shortid.Generate()
+
+	ctx, cancel := context.WithCancel(correlation.NewContext(job.ctx, correlationId))
+	defer cancel()
+
+	stop := context.AfterFunc(scheduler.abort, cancel)
+	defer stop()
+
+	logger := log.FromContext(job.ctx).With(
+		"correlation-id", correlationId,
+		"job", job.id,
+		"command", job.command.Key(),
+	)
+	ctx = log.NewContext(ctx, logger)
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.Errorw("unexpected panic occurred while running scheduled command",
+				"error", recovered,
+				"stacktrace", string(debug.Stack()))
+		}
+	}()
+
+	logger.Infof("Running scheduled command %s", job.command.Key())
+
+	t1 := time.Now()
+	if _, err := scheduler.executor.Execute(ctx, job.command); err != nil {
+		logger.Errorw(fmt.Sprintf("Scheduled command %s failed", job.command.Key()),
+			"error", err,
+			"duration", time.Since(t1))
+
+		return
+	}
+
+	logger.Infow(fmt.Sprintf("Scheduled command %s completed", job.command.Key()), "duration", time.Since(t1))
+}
+
+func (scheduler *Scheduler) randomJitter() time.Duration {
+	if scheduler.jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(scheduler.jitter)))
+}
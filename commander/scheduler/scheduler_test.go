@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/correlation"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+type cleanupSessions struct{}
+
+func (c cleanupSessions) Key() string {
+	return "CleanupSessions"
+}
+
+type recordingExecutor struct {
+	mutex          sync.Mutex
+	correlationIds []string
+}
+
+func (e *recordingExecutor) Execute(ctx context.Context, command commander.Command) (any, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.correlationIds = append(e.correlationIds, correlation.FromContext(ctx))
+
+	return nil, nil
+}
+
+func (e *recordingExecutor) runs() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return append([]string{}, e.correlationIds...)
+}
+
+// onceSchedule runs once at the given time and then never again, like a cron expression that stops matching.
+type onceSchedule struct {
+	at time.Time
+}
+
+func (schedule onceSchedule) Next(t time.Time) time.Time {
+	if t.Before(schedule.at) {
+		return schedule.at
+	}
+
+	return time.Time{}
+}
+
+func TestParseSchedule(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	from := time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)
+
+	t.Run("should parse intervals", func(t *testing.T) {
+		schedule, err := ParseSchedule("90s")
+
+		require.NoError(t, err)
+		assert.Equal(t, from.Add(90*time.Second), schedule.Next(from))
+	})
+
+	t.Run("should parse cron expressions", func(t *testing.T) {
+		schedule, err := ParseSchedule("CRON_TZ=UTC 0 3 * * *")
+
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC), schedule.Next(from))
+	})
+
+	t.Run("should reject invalid schedules", func(t *testing.T) {
+		_, err := ParseSchedule("every now and then")
+		assert.Error(t, err)
+
+		_, err = ParseSchedule("-5m")
+		assert.Error(t, err)
+	})
+
+	t.Run("should not accept a non-positive interval", func(t *testing.T) {
+		_, err := Every(0)
+		assert.Error(t, err)
+
+		_, err = Every(-time.Minute)
+		assert.EqualError(t, err, "the interval -1m0s must be positive")
+
+		schedule, err := Every(time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, time.Unix(60, 0), schedule.Next(time.Unix(0, 0)))
+	})
+}
+
+func TestScheduler(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	t.Run("should run recurring jobs with a fresh correlation id until cancelled", func(t *testing.T) {
+		executor := &recordingExecutor{}
+		scheduler := New(executor)
+
+		id, err := scheduler.ScheduleEvery(context.Background(), "10ms", cleanupSessions{})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return len(executor.runs()) >= 2
+		}, time.Second, time.Millisecond)
+
+		assert.True(t, scheduler.Cancel(id))
+		require.NoError(t, scheduler.Shutdown(context.Background()))
+
+		runs := executor.runs()
+		assert.NotEqual(t, runs[0], runs[1])
+	})
+
+	t.Run("should run one-off jobs once", func(t *testing.T) {
+		executor := &recordingExecutor{}
+		scheduler := New(executor)
+
+		id, err := scheduler.ScheduleAt(context.Background(), time.Now().Add(5*time.Millisecond), cleanupSessions{})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return len(executor.runs()) == 1
+		}, time.Second, time.Millisecond)
+
+		require.NoError(t, scheduler.Shutdown(context.Background()))
+		assert.False(t, scheduler.Cancel(id))
+	})
+
+	t.Run("should reject a schedule without a next run", func(t *testing.T) {
+		scheduler := New(&recordingExecutor{})
+		defer scheduler.Shutdown(context.Background())
+
+		_, err := scheduler.ScheduleOn(context.Background(), onceSchedule{at: time.Now().Add(-time.Minute)}, cleanupSessions{})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should cancel a recurring job once its schedule has no next run", func(t *testing.T) {
+		executor := &recordingExecutor{}
+		scheduler := New(executor)
+
+		id, err := scheduler.ScheduleOn(context.Background(), onceSchedule{at: time.Now().Add(5 * time.Millisecond)}, cleanupSessions{})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return len(executor.runs()) == 1
+		}, time.Second, time.Millisecond)
+
+		require.NoError(t, scheduler.Shutdown(context.Background()))
+		assert.False(t, scheduler.Cancel(id))
+		assert.Len(t, executor.runs(), 1)
+	})
+
+	t.Run("should not accept jobs after shutdown", func(t *testing.T) {
+		scheduler := New(&recordingExecutor{})
+		require.NoError(t, scheduler.Shutdown(context.Background()))
+
+		_, err := scheduler.ScheduleAt(context.Background(), time.Now(), cleanupSessions{})
+
+		assert.ErrorIs(t, err, ErrSchedulerClosed)
+	})
+}
@@ -0,0 +1,137 @@
+package commander
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/correlation"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/commander"
+
+	CommandKeyAttribute     = "command.key"
+	CommandOutcomeAttribute = "command.outcome"
+	CorrelationIdAttribute  = "correlation-id"
+)
+
+const (
+	OutcomeSuccess   = "success"
+	OutcomeInvalid   = "invalid"
+	OutcomeForbidden = "forbidden"
+	OutcomeNotFound  = "not_found"
+	OutcomeError     = "error"
+)
+
+// startCommandSpan starts a span named after the command key with the global tracer provider,
+// as configured by httpmiddleware.InitOpenTelemetryTracer.
+func startCommandSpan(ctx context.Context, command Command) (context.Context, trace.Span) {
+	tracer := otel.GetTracerProvider().Tracer(instrumentationName)
+
+	return tracer.Start(ctx, command.Key(),
+		trace.WithAttributes(
+			attribute.String(CommandKeyAttribute, command.Key()),
+			attribute.String(CorrelationIdAttribute, correlation.FromContext(ctx)),
+		),
+		trace.WithSpanKind(trace.SpanKindInternal),
+	)
+}
+
+// errCommandPanicked is recorded as the error of a command whose handler panicked without being recovered.
+var errCommandPanicked = errors.New("the command panicked")
+
+// commandMetrics holds the instruments created with a meter provider.
+type commandMetrics struct {
+	provider metric.MeterProvider
+	executed metric.Int64Counter
+	duration metric.Int64Histogram
+	err      error
+}
+
+// currentMetrics holds the instruments created with the current global meter provider.
+var currentMetrics atomic.Pointer[commandMetrics]
+
+// metricsFor returns the instruments of the global meter provider, as configured by
+// httpmiddleware.InitOpenTelemetryMeter. They are created once and again only when the global meter provider
+// is replaced. If they can't be created, the error is logged once and the commands aren't measured.
+func metricsFor(ctx context.Context) *commandMetrics {
+	provider := otel.GetMeterProvider()
+	if metrics := currentMetrics.Load(); metrics != nil && metrics.provider == provider {
+		return metrics
+	}
+
+	meter := provider.Meter(instrumentationName)
+	metrics := &commandMetrics{provider: provider}
+
+	executed, executedErr := meter.Int64Counter("commands.executed")
+	duration, durationErr := meter.Int64Histogram("commands.duration", metric.WithUnit("ms"))
+
+	if err := errors.Join(executedErr, durationErr); err != nil {
+		log.FromContext(ctx).Errorw("Failed to create the command metrics -- commands won't be measured", "error", err)
+		metrics.err = err
+	} else {
+		metrics.executed = executed
+		metrics.duration = duration
+	}
+
+	currentMetrics.Store(metrics)
+
+	return metrics
+}
+
+// recordCommand ends the span with the outcome of the command and records the commands.executed counter
+// and the commands.duration histogram.
+func recordCommand(ctx context.Context, span trace.Span, command Command, start time.Time, err error) {
+	outcome := CommandOutcome(err)
+
+	span.SetAttributes(attribute.String(CommandOutcomeAttribute, outcome))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	metrics := metricsFor(ctx)
+	if metrics.err != nil {
+		return
+	}
+
+	attrs := metric.WithAttributes(
+		attribute.String(CommandKeyAttribute, command.Key()),
+		attribute.String(CommandOutcomeAttribute, outcome),
+	)
+
+	metrics.executed.Add(ctx, 1, attrs)
+	metrics.duration.Record(ctx, time.Since(start).Milliseconds(), attrs)
+}
+
+// CommandOutcome classifies the error returned by a command, e.g. OutcomeInvalid for a *ValidationError or
+// OutcomeSuccess for no error, without exposing its message.
+func CommandOutcome(err error) string {
+	var (
+		validationErr *ValidationError
+		forbiddenErr  *ForbiddenError
+		notFoundErr   *HandlerNotFoundError
+	)
+
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.As(err, &validationErr):
+		return OutcomeInvalid
+	case errors.As(err, &forbiddenErr):
+		return OutcomeForbidden
+	case errors.As(err, &notFoundErr):
+		return OutcomeNotFound
+	default:
+		return OutcomeError
+	}
+}
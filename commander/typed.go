@@ -0,0 +1,100 @@
+package commander
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// TypedHandler is the generic counterpart of Handler. It receives the concrete command type C
+// and returns a result of type R, so neither the handler nor its callers need to type-assert.
+// Register a TypedHandler with Register and dispatch to it with Send.
+type TypedHandler[C Command, R any] interface {
+	HandleIt(ctx context.Context, command C) (R, error)
+}
+
+// TypedHandlerFunc is an adapter to allow the use of ordinary functions as a TypedHandler.
+type TypedHandlerFunc[C Command, R any] func(ctx context.Context, command C) (R, error)
+
+// HandleIt calls f(ctx, command).
+func (f TypedHandlerFunc[C, R]) HandleIt(ctx context.Context, command C) (R, error) {
+	return f(ctx, command)
+}
+
+// typedHandler adapts a TypedHandler to the untyped Handler interface so that it can be stored
+// in the same key-based registry as every other handler.
+type typedHandler[C Command, R any] struct {
+	handler TypedHandler[C, R]
+}
+
+func (adapter typedHandler[C, R]) HandleIt(ctx context.Context, command Command) (any, error) {
+	typed, ok := command.(C)
+	if !ok {
+		var zero C
+		return nil, fmt.Errorf("handler for command %s expected a command of type %T but got %T", command.Key(), zero, command)
+	}
+
+	return adapter.handler.HandleIt(ctx, typed)
+}
+
+// Register returns a copy of the given Commander with a TypedHandler added. The command key is taken from
+// the zero value of C, or from a newly allocated value if C is a pointer type, so C.Key() must not depend on
+// the command's fields. It returns a *DuplicateHandlerError if a handler is already registered for the key.
+//
+// Example:
+//
+//	cmdr, err = commander.Register[*CreateTenant, *Tenant](cmdr, createTenantHandler)
+func Register[C Command, R any](commander Commander, handler TypedHandler[C, R]) (Commander, error) {
+	command := ZeroCommand[C]()
+	if commander.registry.Has(command.Key()) {
+		return commander, &DuplicateHandlerError{Key: command.Key()}
+	}
+
+	return commander.WithHandler(typedHandler[C, R]{handler: handler}, command), nil
+}
+
+// Send executes the command with the given Executor and converts the result to R. A nil result
+// is returned as the zero value of R. If the result cannot be converted to R, an error is returned.
+//
+// Example:
+//
+//	tenant, err := commander.Send[*Tenant](ctx, cmdr, &CreateTenant{Name: "acme"})
+func Send[R any](ctx context.Context, executor Executor, command Command) (R, error) {
+	result, err := executor.Execute(ctx, command)
+
+	return typedResult[R]("command", command.Key(), result, err)
+}
+
+// typedResult converts the result of the command or query with the given key to R, as described by Send.
+// The kind, "command" or "query", is only used in the error message.
+func typedResult[R any](kind string, key string, result any, err error) (R, error) {
+	var zero R
+
+	if err != nil {
+		return zero, err
+	}
+
+	if result == nil {
+		return zero, nil
+	}
+
+	typed, ok := result.(R)
+	if !ok {
+		return zero, fmt.Errorf("%s %s returned a result of type %T but %T was expected", kind, key, result, zero)
+	}
+
+	return typed, nil
+}
+
+// ZeroCommand returns a value of C that is safe to call Key() on and to decode a command into. If C is
+// a pointer type, a pointer to a newly allocated zero value is returned instead of a nil pointer.
+func ZeroCommand[C Command]() C {
+	var zero C
+
+	commandType := reflect.TypeOf(&zero).Elem()
+	if commandType.Kind() == reflect.Pointer {
+		return reflect.New(commandType.Elem()).Interface().(C)
+	}
+
+	return zero
+}
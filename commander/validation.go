@@ -0,0 +1,136 @@
+package commander
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+// ValidatableCommand is a Command that can validate itself. The Commander calls Validate after the
+// behaviors, right before the handler, so that the command is authorized, logged and recovered from
+// panics like the handler, and doesn't invoke the handler if it returns an error.
+//
+// Validate can return a *ValidationError, one or more *FieldError joined with errors.Join, or any
+// other error, which is reported as a validation error without a field.
+type ValidatableCommand interface {
+	Command
+	Validate() error
+}
+
+// FieldError describes why the value of a single field of a command is invalid.
+// Field is empty when the error applies to the command as a whole.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// NewFieldError creates a new *FieldError.
+func NewFieldError(field string, message string) *FieldError {
+	return &FieldError{
+		Field:   field,
+		Message: message,
+	}
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationError is returned by the Commander when a command fails validation. It implements
+// render.Renderer so that it can be rendered as a 400 response payload.
+type ValidationError struct {
+	Key     string       `json:"-"`
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors"`
+}
+
+// NewValidationError creates a new *ValidationError for the command with the given key.
+func NewValidationError(key string, fieldErrors ...FieldError) *ValidationError {
+	return &ValidationError{
+		Key:     key,
+		Message: fmt.Sprintf("command %s is invalid", key),
+		Errors:  fieldErrors,
+	}
+}
+
+// Add adds a field error to the Errors collection.
+func (e *ValidationError) Add(field string, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: message})
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for i := range e.Errors {
+		messages = append(messages, e.Errors[i].Error())
+	}
+
+	return fmt.Sprintf("%s: %s", e.Message, strings.Join(messages, "; "))
+}
+
+// Render sets the response status to 400 Bad Request.
+func (e *ValidationError) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusBadRequest)
+
+	return nil
+}
+
+// validationBehavior returns a *ValidationError without invoking the handler if the command is an invalid
+// ValidatableCommand. The Commander wraps every handler with it, inside the configured behaviors.
+func validationBehavior() Behavior {
+	return func(next Handler) Handler {
+		fn := func(ctx context.Context, command Command) (any, error) {
+			if err := validate(command); err != nil {
+				log.FromContext(ctx).Infow("Command failed validation", "command", command.Key(), "error", err)
+
+				return nil, err
+			}
+
+			return next.HandleIt(ctx, command)
+		}
+		return HandlerFunc(fn)
+	}
+}
+
+// validate calls Validate on the command if it is a ValidatableCommand and converts the
+// returned error into a *ValidationError.
+func validate(command Command) error {
+	validatable, ok := command.(ValidatableCommand)
+	if !ok {
+		return nil
+	}
+
+	err := validatable.Validate()
+	if err == nil {
+		return nil
+	}
+
+	return NewValidationError(command.Key(), collectFieldErrors(err)...)
+}
+
+func collectFieldErrors(err error) []FieldError {
+	switch e := err.(type) {
+	case *ValidationError:
+		return e.Errors
+	case *FieldError:
+		return []FieldError{*e}
+	case interface{ Unwrap() []error }:
+		var fieldErrors []FieldError
+		for _, joined := range e.Unwrap() {
+			if joined != nil {
+				fieldErrors = append(fieldErrors, collectFieldErrors(joined)...)
+			}
+		}
+
+		return fieldErrors
+	default:
+		return []FieldError{{Message: err.Error()}}
+	}
+}
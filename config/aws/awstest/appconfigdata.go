@@ -0,0 +1,224 @@
+// Package awstest provides in-memory stand-ins for the AWS AppConfig Data, Systems Manager Parameter Store and
+// Secrets Manager clients used by the config/aws package, so that providers can be tested without a network.
+// They model the behavior of the services that the providers rely on, including errors and throttling.
+package awstest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/appconfigdata"
+	"github.com/aws/aws-sdk-go-v2/service/appconfigdata/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/ptr"
+)
+
+const (
+	defaultPollInterval int32 = 60
+	minPollInterval     int32 = 15
+	maxPollInterval     int32 = 86400
+)
+
+type profileKey struct {
+	application string
+	environment string
+	profile     string
+}
+
+type profile struct {
+	content []byte
+	version int
+}
+
+type sessionToken struct {
+	key          profileKey
+	seenVersion  int
+	pollInterval int32
+	notBefore    time.Time
+}
+
+// AppConfigData is an in-memory AppConfig Data client. Configurations are published per application, environment
+// and profile. Like AppConfig, it hands out single-use configuration tokens, rejects the tokens used before
+// NextPollIntervalInSeconds has elapsed and only returns the content of a configuration to a session that hasn't
+// seen its latest version. Its clock can be moved forward with Advance. It is safe for concurrent use.
+type AppConfigData struct {
+	mutex     sync.Mutex
+	profiles  map[profileKey]*profile
+	tokens    map[string]sessionToken
+	lastToken int
+	sessions  int
+	throttled int
+	elapsed   time.Duration
+}
+
+// NewAppConfigData creates an AppConfig Data client without configurations.
+func NewAppConfigData() *AppConfigData {
+	return &AppConfigData{
+		profiles: map[profileKey]*profile{},
+		tokens:   map[string]sessionToken{},
+	}
+}
+
+// Publish deploys a new version of the configuration and returns its version number, starting at 1.
+func (fake *AppConfigData) Publish(application string, environment string, profileName string, content string) int {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	key := profileKey{application: application, environment: environment, profile: profileName}
+
+	current, ok := fake.profiles[key]
+	if !ok {
+		current = &profile{}
+		fake.profiles[key] = current
+	}
+
+	current.content = []byte(content)
+	current.version++
+
+	return current.version
+}
+
+// Throttle makes the next calls fail with a ThrottlingException.
+func (fake *AppConfigData) Throttle(calls int) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.throttled = calls
+}
+
+// Advance moves the clock of the client forward, as if the duration had passed, e.g. to poll again without
+// waiting for the poll interval. It can be injected as the timer of a poll loop, along with a short real wait.
+func (fake *AppConfigData) Advance(duration time.Duration) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.elapsed += duration
+}
+
+// Sessions returns the number of configuration sessions started so far.
+func (fake *AppConfigData) Sessions() int {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return fake.sessions
+}
+
+func (fake *AppConfigData) StartConfigurationSession(ctx context.Context, params *appconfigdata.StartConfigurationSessionInput, optFns ...func(*appconfigdata.Options)) (*appconfigdata.StartConfigurationSessionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if err := fake.throttle(); err != nil {
+		return nil, err
+	}
+
+	key := profileKey{
+		application: value(params.ApplicationIdentifier),
+		environment: value(params.EnvironmentIdentifier),
+		profile:     value(params.ConfigurationProfileIdentifier),
+	}
+
+	if _, ok := fake.profiles[key]; !ok {
+		return nil, &types.ResourceNotFoundException{
+			Message: ptr.String(fmt.Sprintf("configuration %s/%s/%s not found", key.application, key.environment, key.profile)),
+		}
+	}
+
+	pollInterval := defaultPollInterval
+	if params.RequiredMinimumPollIntervalInSeconds != nil {
+		pollInterval = *params.RequiredMinimumPollIntervalInSeconds
+	}
+
+	if pollInterval < minPollInterval || pollInterval > maxPollInterval {
+		return nil, &types.BadRequestException{
+			Message: ptr.String(fmt.Sprintf("RequiredMinimumPollIntervalInSeconds must be between %d and %d", minPollInterval, maxPollInterval)),
+			Reason:  types.BadRequestReasonInvalidParameters,
+		}
+	}
+
+	fake.sessions++
+
+	return &appconfigdata.StartConfigurationSessionOutput{
+		InitialConfigurationToken: fake.issueToken(sessionToken{key: key, pollInterval: pollInterval}),
+	}, nil
+}
+
+func (fake *AppConfigData) GetLatestConfiguration(ctx context.Context, params *appconfigdata.GetLatestConfigurationInput, optFns ...func(*appconfigdata.Options)) (*appconfigdata.GetLatestConfigurationOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if err := fake.throttle(); err != nil {
+		return nil, err
+	}
+
+	token, ok := fake.tokens[value(params.ConfigurationToken)]
+	if !ok {
+		return nil, &types.BadRequestException{
+			Message: ptr.String("the configuration token is invalid or has already been used"),
+			Reason:  types.BadRequestReasonInvalidParameters,
+		}
+	}
+
+	if fake.now().Before(token.notBefore) {
+		return nil, &types.BadRequestException{
+			Message: ptr.String("the configuration was polled before NextPollIntervalInSeconds elapsed"),
+			Reason:  types.BadRequestReasonInvalidParameters,
+		}
+	}
+
+	delete(fake.tokens, value(params.ConfigurationToken))
+
+	current := fake.profiles[token.key]
+
+	output := &appconfigdata.GetLatestConfigurationOutput{
+		ContentType:               ptr.String("application/x-yaml"),
+		NextPollIntervalInSeconds: token.pollInterval,
+	}
+
+	if token.seenVersion != current.version {
+		output.Configuration = current.content
+	}
+
+	token.seenVersion = current.version
+	token.notBefore = fake.now().Add(time.Duration(token.pollInterval) * time.Second)
+	output.NextPollConfigurationToken = fake.issueToken(token)
+
+	return output, nil
+}
+
+func (fake *AppConfigData) issueToken(token sessionToken) *string {
+	fake.lastToken++
+	id := fmt.Sprintf("token-%d", fake.lastToken)
+	fake.tokens[id] = token
+
+	return &id
+}
+
+// now is the time on the clock of the client. The mutex must be held.
+func (fake *AppConfigData) now() time.Time {
+	return time.Now().Add(fake.elapsed)
+}
+
+func (fake *AppConfigData) throttle() error {
+	if fake.throttled == 0 {
+		return nil
+	}
+
+	fake.throttled--
+
+	return &types.ThrottlingException{Message: ptr.String("Rate exceeded")}
+}
+
+// throttlingError is the error returned by the services without a ThrottlingException type of their own.
+func throttlingError() error {
+	return &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded", Fault: smithy.FaultClient}
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
@@ -0,0 +1,130 @@
+package awstest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/appconfigdata"
+	"github.com/aws/aws-sdk-go-v2/service/appconfigdata/types"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+func TestAppConfigData(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	ctx := context.Background()
+
+	startSession := func(client *AppConfigData, profile string) (*appconfigdata.StartConfigurationSessionOutput, error) {
+		return client.StartConfigurationSession(ctx, &appconfigdata.StartConfigurationSessionInput{
+			ApplicationIdentifier:          ptr.String("app"),
+			EnvironmentIdentifier:          ptr.String("prod"),
+			ConfigurationProfileIdentifier: ptr.String(profile),
+		})
+	}
+
+	t.Run("should only return the content of new versions", func(t *testing.T) {
+		client := NewAppConfigData()
+		client.Publish("app", "prod", "config", "workers: 1\n")
+
+		session, err := startSession(client, "config")
+		require.NoError(t, err)
+
+		first, err := client.GetLatestConfiguration(ctx, &appconfigdata.GetLatestConfigurationInput{ConfigurationToken: session.InitialConfigurationToken})
+		require.NoError(t, err)
+		assert.Equal(t, "workers: 1\n", string(first.Configuration))
+		assert.Equal(t, int32(60), first.NextPollIntervalInSeconds)
+
+		client.Advance(time.Minute)
+		second, err := client.GetLatestConfiguration(ctx, &appconfigdata.GetLatestConfigurationInput{ConfigurationToken: first.NextPollConfigurationToken})
+		require.NoError(t, err)
+		assert.Empty(t, second.Configuration)
+
+		assert.Equal(t, 2, client.Publish("app", "prod", "config", "workers: 2\n"))
+
+		client.Advance(time.Minute)
+		third, err := client.GetLatestConfiguration(ctx, &appconfigdata.GetLatestConfigurationInput{ConfigurationToken: second.NextPollConfigurationToken})
+		require.NoError(t, err)
+		assert.Equal(t, "workers: 2\n", string(third.Configuration))
+		assert.Equal(t, 1, client.Sessions())
+	})
+
+	t.Run("should reject a used token", func(t *testing.T) {
+		client := NewAppConfigData()
+		client.Publish("app", "prod", "config", "workers: 1\n")
+
+		session, err := startSession(client, "config")
+		require.NoError(t, err)
+
+		input := &appconfigdata.GetLatestConfigurationInput{ConfigurationToken: session.InitialConfigurationToken}
+		_, err = client.GetLatestConfiguration(ctx, input)
+		require.NoError(t, err)
+
+		_, err = client.GetLatestConfiguration(ctx, input)
+
+		var badRequestErr *types.BadRequestException
+		assert.ErrorAs(t, err, &badRequestErr)
+	})
+
+	t.Run("should reject a token used before the poll interval", func(t *testing.T) {
+		client := NewAppConfigData()
+		client.Publish("app", "prod", "config", "workers: 1\n")
+
+		session, err := startSession(client, "config")
+		require.NoError(t, err)
+
+		first, err := client.GetLatestConfiguration(ctx, &appconfigdata.GetLatestConfigurationInput{ConfigurationToken: session.InitialConfigurationToken})
+		require.NoError(t, err)
+
+		input := &appconfigdata.GetLatestConfigurationInput{ConfigurationToken: first.NextPollConfigurationToken}
+		_, err = client.GetLatestConfiguration(ctx, input)
+
+		var badRequestErr *types.BadRequestException
+		assert.ErrorAs(t, err, &badRequestErr)
+
+		client.Advance(59 * time.Second)
+		_, err = client.GetLatestConfiguration(ctx, input)
+		assert.ErrorAs(t, err, &badRequestErr)
+
+		client.Advance(time.Second)
+		_, err = client.GetLatestConfiguration(ctx, input)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should reject unknown profiles and invalid poll intervals", func(t *testing.T) {
+		client := NewAppConfigData()
+		client.Publish("app", "prod", "config", "workers: 1\n")
+
+		_, err := startSession(client, "missing")
+
+		var notFoundErr *types.ResourceNotFoundException
+		assert.ErrorAs(t, err, &notFoundErr)
+
+		_, err = client.StartConfigurationSession(ctx, &appconfigdata.StartConfigurationSessionInput{
+			ApplicationIdentifier:                ptr.String("app"),
+			EnvironmentIdentifier:                ptr.String("prod"),
+			ConfigurationProfileIdentifier:       ptr.String("config"),
+			RequiredMinimumPollIntervalInSeconds: ptr.Int32(5),
+		})
+
+		var badRequestErr *types.BadRequestException
+		assert.ErrorAs(t, err, &badRequestErr)
+	})
+
+	t.Run("should throttle the next calls", func(t *testing.T) {
+		client := NewAppConfigData()
+		client.Publish("app", "prod", "config", "workers: 1\n")
+		client.Throttle(1)
+
+		_, err := startSession(client, "config")
+
+		var throttlingErr *types.ThrottlingException
+		assert.ErrorAs(t, err, &throttlingErr)
+
+		_, err = startSession(client, "config")
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,137 @@
+package awstest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/smithy-go/ptr"
+)
+
+const (
+	stageCurrent  = "AWSCURRENT"
+	stagePrevious = "AWSPREVIOUS"
+)
+
+type secretVersion struct {
+	id     string
+	value  string
+	stages map[string]bool
+}
+
+// SecretsManager is an in-memory Secrets Manager client. Like Secrets Manager, it keeps the versions of a secret
+// with their version stages and returns the AWSCURRENT version unless another stage or version is requested.
+// It is safe for concurrent use.
+type SecretsManager struct {
+	mutex     sync.Mutex
+	secrets   map[string][]*secretVersion
+	calls     []string
+	throttled int
+}
+
+// NewSecretsManager creates a Secrets Manager client without secrets.
+func NewSecretsManager() *SecretsManager {
+	return &SecretsManager{
+		secrets: map[string][]*secretVersion{},
+	}
+}
+
+// PutSecretValue adds a new version of the secret with the version stages, or AWSCURRENT if none are given, and
+// returns its version id. Like Secrets Manager, the stages are moved from the previous versions and the previous
+// AWSCURRENT version becomes AWSPREVIOUS.
+func (fake *SecretsManager) PutSecretValue(name string, value string, stages ...string) string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if len(stages) == 0 {
+		stages = []string{stageCurrent}
+	}
+
+	version := &secretVersion{
+		id:     fmt.Sprintf("%s-v%d", name, len(fake.secrets[name])+1),
+		value:  value,
+		stages: map[string]bool{},
+	}
+
+	for _, stage := range stages {
+		for _, previous := range fake.secrets[name] {
+			if !previous.stages[stage] {
+				continue
+			}
+
+			delete(previous.stages, stage)
+
+			if stage == stageCurrent {
+				for _, other := range fake.secrets[name] {
+					delete(other.stages, stagePrevious)
+				}
+
+				previous.stages[stagePrevious] = true
+			}
+		}
+
+		version.stages[stage] = true
+	}
+
+	fake.secrets[name] = append(fake.secrets[name], version)
+
+	return version.id
+}
+
+// Throttle makes the next calls fail with a ThrottlingException.
+func (fake *SecretsManager) Throttle(calls int) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.throttled = calls
+}
+
+// GetSecretValueCalls returns the secret ids requested by every GetSecretValue call so far.
+func (fake *SecretsManager) GetSecretValueCalls() []string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return append([]string{}, fake.calls...)
+}
+
+func (fake *SecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if fake.throttled > 0 {
+		fake.throttled--
+		return nil, throttlingError()
+	}
+
+	name := value(params.SecretId)
+	fake.calls = append(fake.calls, name)
+
+	stage := value(params.VersionStage)
+	if stage == "" && params.VersionId == nil {
+		stage = stageCurrent
+	}
+
+	for _, version := range fake.secrets[name] {
+		if (params.VersionId != nil && version.id != *params.VersionId) || (stage != "" && !version.stages[stage]) {
+			continue
+		}
+
+		output := &secretsmanager.GetSecretValueOutput{
+			Name:         ptr.String(name),
+			SecretString: ptr.String(version.value),
+			VersionId:    ptr.String(version.id),
+		}
+
+		for stage := range version.stages {
+			output.VersionStages = append(output.VersionStages, stage)
+		}
+
+		return output, nil
+	}
+
+	return nil, &types.ResourceNotFoundException{
+		Message: ptr.String(fmt.Sprintf("secrets Manager can't find the specified secret value for %s", name)),
+	}
+}
@@ -0,0 +1,79 @@
+package awstest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+func TestSecretsManager(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	ctx := context.Background()
+
+	getSecret := func(client *SecretsManager, stage string) (string, error) {
+		input := &secretsmanager.GetSecretValueInput{SecretId: ptr.String("prod/db")}
+		if stage != "" {
+			input.VersionStage = &stage
+		}
+
+		output, err := client.GetSecretValue(ctx, input)
+		if err != nil {
+			return "", err
+		}
+
+		return *output.SecretString, nil
+	}
+
+	t.Run("should move the stages to the new versions", func(t *testing.T) {
+		client := NewSecretsManager()
+		client.PutSecretValue("prod/db", "one")
+		client.PutSecretValue("prod/db", "two")
+		client.PutSecretValue("prod/db", "three", "AWSPENDING")
+
+		current, err := getSecret(client, "")
+		require.NoError(t, err)
+		assert.Equal(t, "two", current)
+
+		previous, err := getSecret(client, "AWSPREVIOUS")
+		require.NoError(t, err)
+		assert.Equal(t, "one", previous)
+
+		pending, err := getSecret(client, "AWSPENDING")
+		require.NoError(t, err)
+		assert.Equal(t, "three", pending)
+
+		assert.Len(t, client.GetSecretValueCalls(), 3)
+	})
+
+	t.Run("should fail on missing secrets and stages", func(t *testing.T) {
+		client := NewSecretsManager()
+		client.PutSecretValue("prod/db", "one")
+
+		_, err := getSecret(client, "AWSPENDING")
+
+		var notFoundErr *types.ResourceNotFoundException
+		assert.ErrorAs(t, err, &notFoundErr)
+	})
+
+	t.Run("should throttle the next calls", func(t *testing.T) {
+		client := NewSecretsManager()
+		client.PutSecretValue("prod/db", "one")
+		client.Throttle(2)
+
+		_, err := getSecret(client, "")
+		assert.ErrorContains(t, err, "ThrottlingException")
+
+		_, err = getSecret(client, "")
+		assert.Error(t, err)
+
+		_, err = getSecret(client, "")
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,211 @@
+package awstest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/ptr"
+)
+
+const (
+	maxParametersPerCall = 10
+	maxResultsPerPage    = 10
+)
+
+// Ssm is an in-memory Systems Manager Parameter Store client. Like Parameter Store, it rejects more than 10 names
+// per GetParameters call, reports the names that don't exist as invalid parameters, only returns the values of
+// SecureString parameters when they are decrypted and returns GetParametersByPath results in pages. It is safe
+// for concurrent use.
+type Ssm struct {
+	mutex      sync.Mutex
+	parameters map[string]types.Parameter
+	calls      [][]string
+	throttled  int
+}
+
+// NewSsm creates a Parameter Store client without parameters.
+func NewSsm() *Ssm {
+	return &Ssm{
+		parameters: map[string]types.Parameter{},
+	}
+}
+
+// PutParameter creates or updates a String parameter.
+func (fake *Ssm) PutParameter(name string, value string) {
+	fake.put(name, value, types.ParameterTypeString)
+}
+
+// PutSecureString creates or updates a SecureString parameter.
+func (fake *Ssm) PutSecureString(name string, value string) {
+	fake.put(name, value, types.ParameterTypeSecureString)
+}
+
+// PutStringList creates or updates a StringList parameter.
+func (fake *Ssm) PutStringList(name string, values ...string) {
+	fake.put(name, strings.Join(values, ","), types.ParameterTypeStringList)
+}
+
+// DeleteParameter deletes the parameter.
+func (fake *Ssm) DeleteParameter(name string) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	delete(fake.parameters, name)
+}
+
+// Throttle makes the next calls fail with a ThrottlingException.
+func (fake *Ssm) Throttle(calls int) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.throttled = calls
+}
+
+// GetParametersCalls returns the names requested by every GetParameters call so far.
+func (fake *Ssm) GetParametersCalls() [][]string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return append([][]string{}, fake.calls...)
+}
+
+func (fake *Ssm) GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if err := fake.throttle(); err != nil {
+		return nil, err
+	}
+
+	if len(params.Names) == 0 || len(params.Names) > maxParametersPerCall {
+		return nil, validationError(fmt.Sprintf("names must contain between 1 and %d items", maxParametersPerCall))
+	}
+
+	fake.calls = append(fake.calls, append([]string{}, params.Names...))
+
+	output := &ssm.GetParametersOutput{}
+
+	for _, name := range params.Names {
+		param, ok := fake.parameters[name]
+		if !ok {
+			output.InvalidParameters = append(output.InvalidParameters, name)
+			continue
+		}
+
+		output.Parameters = append(output.Parameters, decrypt(param, params.WithDecryption))
+	}
+
+	return output, nil
+}
+
+func (fake *Ssm) GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if err := fake.throttle(); err != nil {
+		return nil, err
+	}
+
+	path := value(params.Path)
+	if !strings.HasPrefix(path, "/") {
+		return nil, validationError("path must start with /")
+	}
+
+	pageSize := maxResultsPerPage
+	if params.MaxResults != nil {
+		pageSize = int(*params.MaxResults)
+	}
+
+	if pageSize < 1 || pageSize > maxResultsPerPage {
+		return nil, validationError(fmt.Sprintf("max results must be between 1 and %d", maxResultsPerPage))
+	}
+
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	recursive := params.Recursive != nil && *params.Recursive
+
+	var names []string
+	for name := range fake.parameters {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		if !recursive && strings.Contains(strings.TrimPrefix(name, prefix), "/") {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	start := 0
+	if params.NextToken != nil {
+		var err error
+
+		start, err = strconv.Atoi(*params.NextToken)
+		if err != nil || start < 0 || start > len(names) {
+			return nil, &types.InvalidNextToken{Message: ptr.String("the next token is invalid")}
+		}
+	}
+
+	end := start + pageSize
+	if end > len(names) {
+		end = len(names)
+	}
+
+	output := &ssm.GetParametersByPathOutput{}
+
+	for _, name := range names[start:end] {
+		output.Parameters = append(output.Parameters, decrypt(fake.parameters[name], params.WithDecryption))
+	}
+
+	if end < len(names) {
+		output.NextToken = ptr.String(strconv.Itoa(end))
+	}
+
+	return output, nil
+}
+
+func (fake *Ssm) put(name string, value string, parameterType types.ParameterType) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	version := fake.parameters[name].Version + 1
+
+	fake.parameters[name] = types.Parameter{
+		Name:    ptr.String(name),
+		Value:   ptr.String(value),
+		Type:    parameterType,
+		Version: version,
+	}
+}
+
+func (fake *Ssm) throttle() error {
+	if fake.throttled == 0 {
+		return nil
+	}
+
+	fake.throttled--
+
+	return throttlingError()
+}
+
+// decrypt returns the parameter with its value encrypted unless it is decrypted or not a SecureString.
+func decrypt(param types.Parameter, withDecryption *bool) types.Parameter {
+	if param.Type == types.ParameterTypeSecureString && (withDecryption == nil || !*withDecryption) {
+		param.Value = ptr.String("encrypted:" + value(param.Name))
+	}
+
+	return param
+}
+
+func validationError(message string) error {
+	return &smithy.GenericAPIError{Code: "ValidationException", Message: message, Fault: smithy.FaultClient}
+}
@@ -0,0 +1,134 @@
+package awstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+func TestSsm(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	ctx := context.Background()
+
+	t.Run("should get parameters and report the invalid ones", func(t *testing.T) {
+		client := NewSsm()
+		client.PutParameter("/app/name", "one")
+		client.PutParameter("/app/name", "two")
+		client.PutSecureString("/app/password", "hunter2")
+
+		output, err := client.GetParameters(ctx, &ssm.GetParametersInput{
+			Names:          []string{"/app/name", "/app/password", "/app/missing"},
+			WithDecryption: ptr.Bool(true),
+		})
+
+		require.NoError(t, err)
+		require.Len(t, output.Parameters, 2)
+		assert.Equal(t, "two", *output.Parameters[0].Value)
+		assert.Equal(t, int64(2), output.Parameters[0].Version)
+		assert.Equal(t, "hunter2", *output.Parameters[1].Value)
+		assert.Equal(t, []string{"/app/missing"}, output.InvalidParameters)
+	})
+
+	t.Run("should not decrypt secure strings unless asked to", func(t *testing.T) {
+		client := NewSsm()
+		client.PutSecureString("/app/password", "hunter2")
+
+		output, err := client.GetParameters(ctx, &ssm.GetParametersInput{Names: []string{"/app/password"}})
+
+		require.NoError(t, err)
+		assert.NotEqual(t, "hunter2", *output.Parameters[0].Value)
+	})
+
+	t.Run("should reject more than 10 names", func(t *testing.T) {
+		var names []string
+		for i := 0; i < 11; i++ {
+			names = append(names, fmt.Sprintf("/app/%d", i))
+		}
+
+		_, err := NewSsm().GetParameters(ctx, &ssm.GetParametersInput{Names: names})
+
+		var apiErr smithy.APIError
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, "ValidationException", apiErr.ErrorCode())
+	})
+
+	t.Run("should get parameters by path in pages", func(t *testing.T) {
+		client := NewSsm()
+		for i := 0; i < 12; i++ {
+			client.PutParameter(fmt.Sprintf("/app/prod/%02d", i), "value")
+		}
+
+		client.PutStringList("/app/prod/db/hosts", "db1", "db2")
+		client.PutParameter("/app/staging/name", "staging")
+		client.DeleteParameter("/app/prod/11")
+
+		var names []string
+		input := &ssm.GetParametersByPathInput{Path: ptr.String("/app/prod"), Recursive: ptr.Bool(true)}
+
+		for {
+			output, err := client.GetParametersByPath(ctx, input)
+			require.NoError(t, err)
+
+			for _, param := range output.Parameters {
+				names = append(names, *param.Name)
+			}
+
+			if output.NextToken == nil {
+				break
+			}
+
+			input.NextToken = output.NextToken
+		}
+
+		assert.Len(t, names, 12)
+		assert.Contains(t, names, "/app/prod/db/hosts")
+		assert.NotContains(t, names, "/app/prod/11")
+
+		output, err := client.GetParametersByPath(ctx, &ssm.GetParametersByPathInput{Path: ptr.String("/app/prod/db")})
+		require.NoError(t, err)
+		assert.Equal(t, types.ParameterTypeStringList, output.Parameters[0].Type)
+		assert.Equal(t, "db1,db2", *output.Parameters[0].Value)
+
+		_, err = client.GetParametersByPath(ctx, &ssm.GetParametersByPathInput{Path: ptr.String("/app/prod"), NextToken: ptr.String("invalid")})
+
+		var tokenErr *types.InvalidNextToken
+		assert.ErrorAs(t, err, &tokenErr)
+	})
+
+	t.Run("should only list direct children unless recursive", func(t *testing.T) {
+		client := NewSsm()
+		client.PutParameter("/app/prod/name", "prod")
+		client.PutParameter("/app/prod/db/password", "hunter2")
+
+		output, err := client.GetParametersByPath(ctx, &ssm.GetParametersByPathInput{Path: ptr.String("/app/prod")})
+
+		require.NoError(t, err)
+		require.Len(t, output.Parameters, 1)
+		assert.Equal(t, "/app/prod/name", *output.Parameters[0].Name)
+	})
+
+	t.Run("should throttle the next calls", func(t *testing.T) {
+		client := NewSsm()
+		client.PutParameter("/app/name", "one")
+		client.Throttle(1)
+
+		_, err := client.GetParameters(ctx, &ssm.GetParametersInput{Names: []string{"/app/name"}})
+
+		var apiErr smithy.APIError
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, "ThrottlingException", apiErr.ErrorCode())
+
+		_, err = client.GetParameters(ctx, &ssm.GetParametersInput{Names: []string{"/app/name"}})
+		assert.NoError(t, err)
+	})
+}
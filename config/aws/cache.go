@@ -0,0 +1,197 @@
+package aws
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	goutilslog "gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+// Status tells whether the config of a Provider was loaded from AWS or from the last-known-good cache, and
+// whether Watch failed to reload it, e.g. to report it in a health check.
+type Status struct {
+	// Fallback is true when the config couldn't be loaded from AWS and was loaded from the cache instead.
+	Fallback bool
+
+	// Err is the error that caused the fallback.
+	Err error
+
+	// CachedAt is when the config loaded from the cache was saved.
+	CachedAt time.Time
+
+	// ReloadErr is the error of the last poll or reload by Watch that failed, until the config is reloaded.
+	ReloadErr error
+}
+
+// configCache stores a config encrypted with AES-GCM in a file. The nonce is stored before the ciphertext.
+type configCache struct {
+	path string
+	key  []byte
+}
+
+// save encrypts the content and atomically replaces the cache file with it. The additional data is authenticated
+// but not stored, so the content can only be loaded with the same additional data.
+func (cache *configCache) save(content []byte, additionalData []byte) error {
+	gcm, err := cache.gcm()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cache.path), 0o700); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(cache.path), filepath.Base(cache.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(gcm.Seal(nonce, nonce, content, additionalData))
+	if err = errors.Join(err, file.Close()); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), cache.path)
+}
+
+// load decrypts the content of the cache file and returns it with the time it was saved.
+func (cache *configCache) load(additionalData []byte) ([]byte, time.Time, error) {
+	gcm, err := cache.gcm()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	info, err := os.Stat(cache.path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	sealed, err := os.ReadFile(cache.path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, time.Time{}, errors.New("the cache file is truncated")
+	}
+
+	content, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("could not decrypt the cache file: %w", err)
+	}
+
+	return content, info.ModTime(), nil
+}
+
+func (cache *configCache) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cache.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// WithLastKnownGood keeps the last config that was loaded and validated in a file at path, encrypted with AES-GCM
+// using the key, which must be 16, 24 or 32 bytes long. When the config can't be loaded from AWS, or isn't valid,
+// GetConfig and Watch load the config from the file instead and report it with Status. Only the fields that are
+// marshalled to YAML are kept. It returns an error, and keeps the provider unchanged, if the key has another length.
+func (provider *Provider[T]) WithLastKnownGood(path string, key []byte) error {
+	if _, err := aes.NewCipher(key); err != nil {
+		return fmt.Errorf("invalid last known good config key: %w", err)
+	}
+
+	provider.cache = &configCache{path: path, key: key}
+
+	return nil
+}
+
+// Status tells whether the current config was loaded from the last-known-good cache and whether Watch failed
+// to reload it.
+func (provider *Provider[T]) Status() Status {
+	if status := provider.status.Load(); status != nil {
+		return *status
+	}
+
+	return Status{}
+}
+
+// remember saves the config to the last-known-good cache, if any. A failure to save it is only logged.
+func (provider *Provider[T]) remember(ctx context.Context, cfg T) {
+	provider.status.Store(&Status{})
+
+	if provider.cache == nil {
+		return
+	}
+
+	log := goutilslog.FromContext(ctx)
+
+	content, err := yaml.Marshal(cfg)
+	if err == nil {
+		err = provider.cache.save(content, provider.cacheAdditionalData())
+	}
+
+	if err != nil {
+		log.Warnw("Failed to save the last known good config", "path", provider.cache.path, "error", err)
+		return
+	}
+
+	log.Infow("Saved the last known good config", "path", provider.cache.path)
+}
+
+// fallback loads the config from the last-known-good cache into cfg after loading it from AWS failed with err.
+// It returns err, joined with the cache error, if there is no cache or it can't be loaded.
+func (provider *Provider[T]) fallback(ctx context.Context, cfg T, err error) error {
+	if provider.cache == nil {
+		return err
+	}
+
+	log := goutilslog.FromContext(ctx)
+
+	content, cachedAt, cacheErr := provider.cache.load(provider.cacheAdditionalData())
+	if cacheErr == nil {
+		if value := reflect.ValueOf(cfg); value.Kind() == reflect.Pointer && !value.IsNil() {
+			value.Elem().SetZero()
+		}
+
+		cacheErr = yaml.Unmarshal(content, cfg)
+	}
+
+	if cacheErr == nil {
+		cacheErr = cfg.Validate()
+	}
+
+	if cacheErr != nil {
+		log.Errorw("Failed to load the config from AWS and from the last known good config", "path", provider.cache.path, "error", err, "cacheError", cacheErr)
+		return errors.Join(err, fmt.Errorf("failed to load the last known good config: %w", cacheErr))
+	}
+
+	provider.status.Store(&Status{Fallback: true, Err: err, CachedAt: cachedAt})
+
+	log.Errorw("FAILED TO LOAD THE CONFIG FROM AWS, USING THE LAST KNOWN GOOD CONFIG", "path", provider.cache.path, "cachedAt", cachedAt, "error", err)
+
+	return nil
+}
+
+// cacheAdditionalData ties the cache to the AppConfig application, environment and profile.
+func (provider *Provider[T]) cacheAdditionalData() []byte {
+	return []byte(provider.application + "/" + provider.env + "/" + provider.configProfile)
+}
@@ -0,0 +1,149 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/appconfigdata/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+func TestLastKnownGood(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{7}, 32)
+
+	t.Run("should reject a key that isn't 16, 24 or 32 bytes long", func(t *testing.T) {
+		provider := newTestProvider(newTestAppConfigData("broker-addr: amqp://one\n"))
+
+		err := provider.WithLastKnownGood(filepath.Join(t.TempDir(), "config.enc"), []byte("too short"))
+
+		assert.ErrorContains(t, err, "invalid key size 9")
+		assert.Nil(t, provider.cache)
+	})
+
+	t.Run("should fall back to the last config loaded when AppConfig fails", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache", "config.enc")
+		client := newTestAppConfigData("broker-addr: amqp://secret-broker\nworkers: 2\n")
+		provider := newTestProvider(client)
+		require.NoError(t, provider.WithLastKnownGood(path, key))
+
+		require.NoError(t, provider.GetConfig(ctx, &watchConfig{}))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(content), "secret-broker")
+
+		client.Throttle(1)
+
+		cfg := &watchConfig{}
+		err = provider.GetConfig(ctx, cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, watchConfig{BrokerAddr: "amqp://secret-broker", Workers: 2}, *cfg)
+
+		var throttlingErr *types.ThrottlingException
+		status := provider.Status()
+		assert.True(t, status.Fallback)
+		assert.ErrorAs(t, status.Err, &throttlingErr)
+		assert.False(t, status.CachedAt.IsZero())
+
+		require.NoError(t, provider.GetConfig(ctx, &watchConfig{}))
+		assert.False(t, provider.Status().Fallback)
+	})
+
+	t.Run("should fall back when the new config is invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.enc")
+		client := newTestAppConfigData("broker-addr: amqp://one\n")
+		provider := newTestProvider(client)
+		require.NoError(t, provider.WithLastKnownGood(path, key))
+
+		require.NoError(t, provider.GetConfig(ctx, &watchConfig{}))
+
+		client.Publish("app", "env", "profile", "workers: 3\n")
+
+		cfg := &watchConfig{}
+		err := provider.GetConfig(ctx, cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, watchConfig{BrokerAddr: "amqp://one"}, *cfg)
+		assert.ErrorContains(t, provider.Status().Err, "broker-addr is required")
+	})
+
+	t.Run("should report both errors when there is no cached config", func(t *testing.T) {
+		client := newTestAppConfigData("broker-addr: amqp://one\n")
+		client.Throttle(1)
+		provider := newTestProvider(client)
+		require.NoError(t, provider.WithLastKnownGood(filepath.Join(t.TempDir(), "config.enc"), key))
+
+		err := provider.GetConfig(ctx, &watchConfig{})
+
+		var throttlingErr *types.ThrottlingException
+		assert.ErrorAs(t, err, &throttlingErr)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.False(t, provider.Status().Fallback)
+	})
+
+	t.Run("should not load a config cached with another key or for another config", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.enc")
+		provider := newTestProvider(newTestAppConfigData("broker-addr: amqp://one\n"))
+		require.NoError(t, provider.WithLastKnownGood(path, key))
+
+		require.NoError(t, provider.GetConfig(ctx, &watchConfig{}))
+
+		client := newTestAppConfigData("broker-addr: amqp://one\n")
+		client.Throttle(2)
+
+		otherKey := newTestProvider(client)
+		require.NoError(t, otherKey.WithLastKnownGood(path, bytes.Repeat([]byte{8}, 32)))
+		assert.ErrorContains(t, otherKey.GetConfig(ctx, &watchConfig{}), "could not decrypt the cache file")
+
+		otherEnv := newTestProvider(client)
+		otherEnv.env = "other"
+		require.NoError(t, otherEnv.WithLastKnownGood(path, key))
+		assert.ErrorContains(t, otherEnv.GetConfig(ctx, &watchConfig{}), "could not decrypt the cache file")
+	})
+
+	t.Run("should watch from the cached config until AppConfig recovers", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.enc")
+		require.NoError(t, func() error {
+			provider := newTestProvider(newTestAppConfigData("broker-addr: amqp://cached\n"))
+			require.NoError(t, provider.WithLastKnownGood(path, key))
+
+			return provider.GetConfig(ctx, &watchConfig{})
+		}())
+
+		client := newTestAppConfigData("broker-addr: amqp://remote\n")
+		client.Throttle(20)
+		provider := newTestProvider(client)
+		require.NoError(t, provider.WithLastKnownGood(path, key))
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		changes := make(chan [2]*watchConfig, 1)
+		err := provider.Watch(ctx, func(old *watchConfig, new *watchConfig) {
+			changes <- [2]*watchConfig{old, new}
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, "amqp://cached", provider.Current().BrokerAddr)
+		assert.True(t, provider.Status().Fallback)
+
+		select {
+		case change := <-changes:
+			assert.Equal(t, "amqp://cached", change[0].BrokerAddr)
+			assert.Equal(t, "amqp://remote", change[1].BrokerAddr)
+			assert.False(t, provider.Status().Fallback)
+		case <-time.After(time.Second):
+			require.Fail(t, "config change was not notified")
+		}
+	})
+}
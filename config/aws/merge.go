@@ -0,0 +1,143 @@
+package aws
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+)
+
+// MergeStrategy determines how a value from Parameter Store is merged into the config at a given path.
+type MergeStrategy int
+
+const (
+	// MergeMaps merges maps recursively and replaces any other value. This is the default.
+	MergeMaps MergeStrategy = iota
+
+	// Replace replaces the value, including maps, as a whole.
+	Replace
+
+	// AppendLists appends lists to the existing lists, merges maps recursively and replaces any other value.
+	AppendLists
+
+	// FailOnConflict merges maps recursively and fails if any other value already exists with a different value.
+	FailOnConflict
+)
+
+func (strategy MergeStrategy) String() string {
+	switch strategy {
+	case MergeMaps:
+		return "merge-maps"
+	case Replace:
+		return "replace"
+	case AppendLists:
+		return "append-lists"
+	case FailOnConflict:
+		return "fail-on-conflict"
+	default:
+		return fmt.Sprintf("MergeStrategy(%d)", int(strategy))
+	}
+}
+
+// MergeConflictError is returned when a Parameter Store value conflicts with a config value at a path
+// with the FailOnConflict strategy.
+type MergeConflictError struct {
+	Path      string
+	Parameter string
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("parameter %s conflicts with the config value at %s", e.Parameter, e.Path)
+}
+
+// merger deep merges maps unmarshalled from YAML with the strategies configured per path.
+type merger struct {
+	strategies map[string]MergeStrategy
+}
+
+// strategyFor returns the strategy of the path or of its closest parent with a strategy.
+func (merger merger) strategyFor(path string) MergeStrategy {
+	for {
+		if strategy, ok := merger.strategies[path]; ok {
+			return strategy
+		}
+
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			return MergeMaps
+		}
+
+		path = path[:i]
+	}
+}
+
+// merge merges source into target and returns the paths of the values in target that were overridden
+// with a different value. Only the target is modified, and only if the whole merge succeeds, so a conflict
+// leaves it as it was.
+func (merger merger) merge(target map[string]any, source map[string]any, path string) ([]string, error) {
+	merged, overridden, err := merger.mergeMaps(target, source, path)
+	if err != nil {
+		return nil, err
+	}
+
+	maps.Copy(target, merged)
+
+	return overridden, nil
+}
+
+// mergeMaps returns a copy of target with source merged into it, along with the paths of the values that
+// were overridden with a different value. Neither target nor source is modified.
+func (merger merger) mergeMaps(target map[string]any, source map[string]any, path string) (map[string]any, []string, error) {
+	merged := make(map[string]any, len(target)+len(source))
+	maps.Copy(merged, target)
+
+	var overridden []string
+
+	for key, sourceValue := range source {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		targetValue, exists := merged[key]
+		if !exists {
+			merged[key] = sourceValue
+			continue
+		}
+
+		targetMap, targetIsMap := targetValue.(map[string]any)
+		sourceMap, sourceIsMap := sourceValue.(map[string]any)
+		targetList, targetIsList := targetValue.([]any)
+		sourceList, sourceIsList := sourceValue.([]any)
+
+		strategy := merger.strategyFor(keyPath)
+
+		switch {
+		case strategy != Replace && targetIsMap && sourceIsMap:
+			nested, nestedOverridden, err := merger.mergeMaps(targetMap, sourceMap, keyPath)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			merged[key] = nested
+			overridden = append(overridden, nestedOverridden...)
+			continue
+		case strategy == AppendLists && targetIsList && sourceIsList:
+			merged[key] = append(append([]any{}, targetList...), sourceList...)
+			continue
+		}
+
+		if reflect.DeepEqual(targetValue, sourceValue) {
+			continue
+		}
+
+		if strategy == FailOnConflict {
+			return nil, nil, &MergeConflictError{Path: keyPath}
+		}
+
+		merged[key] = sourceValue
+		overridden = append(overridden, keyPath)
+	}
+
+	return merged, overridden, nil
+}
@@ -0,0 +1,115 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config/aws/awstest"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+	"gopkg.in/yaml.v3"
+)
+
+func unmarshalMap(t *testing.T, content string) map[string]any {
+	result := map[string]any{}
+	require.NoError(t, yaml.Unmarshal([]byte(content), result))
+
+	return result
+}
+
+func TestMerge(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	base := `
+broker:
+  addr: amqp://localhost
+  username: admin
+  hosts: [a, b]
+mongo:
+  url: mongodb://localhost
+`
+
+	t.Run("should merge maps recursively by default", func(t *testing.T) {
+		target := unmarshalMap(t, base)
+
+		overridden, err := merger{}.merge(target, unmarshalMap(t, "broker:\n  username: svc\n  password: secret\n"), "")
+
+		require.NoError(t, err)
+		assert.Equal(t, unmarshalMap(t, `
+broker:
+  addr: amqp://localhost
+  username: svc
+  password: secret
+  hosts: [a, b]
+mongo:
+  url: mongodb://localhost
+`), target)
+		assert.Equal(t, []string{"broker.username"}, overridden)
+	})
+
+	t.Run("should apply the strategy of the closest path", func(t *testing.T) {
+		target := unmarshalMap(t, base)
+		merger := merger{strategies: map[string]MergeStrategy{
+			"broker":       AppendLists,
+			"broker.hosts": Replace,
+			"mongo":        Replace,
+		}}
+
+		overridden, err := merger.merge(target, unmarshalMap(t, "broker:\n  hosts: [c]\nmongo:\n  password: secret\n"), "")
+
+		require.NoError(t, err)
+		assert.Equal(t, []any{"c"}, target["broker"].(map[string]any)["hosts"])
+		assert.Equal(t, map[string]any{"password": "secret"}, target["mongo"])
+		assert.ElementsMatch(t, []string{"broker.hosts", "mongo"}, overridden)
+	})
+
+	t.Run("should append lists", func(t *testing.T) {
+		target := unmarshalMap(t, base)
+		merger := merger{strategies: map[string]MergeStrategy{"broker": AppendLists}}
+
+		overridden, err := merger.merge(target, unmarshalMap(t, "broker:\n  hosts: [c]\n"), "")
+
+		require.NoError(t, err)
+		assert.Equal(t, []any{"a", "b", "c"}, target["broker"].(map[string]any)["hosts"])
+		assert.Empty(t, overridden)
+	})
+
+	t.Run("should fail on conflicts only with different values", func(t *testing.T) {
+		merger := merger{strategies: map[string]MergeStrategy{"broker": FailOnConflict}}
+
+		_, err := merger.merge(unmarshalMap(t, base), unmarshalMap(t, "broker:\n  username: admin\n  password: secret\n"), "")
+		require.NoError(t, err)
+
+		_, err = merger.merge(unmarshalMap(t, base), unmarshalMap(t, "broker:\n  username: svc\n"), "")
+
+		var conflictErr *MergeConflictError
+		require.ErrorAs(t, err, &conflictErr)
+		assert.Equal(t, "broker.username", conflictErr.Path)
+	})
+
+	t.Run("should leave the target unchanged on a conflict", func(t *testing.T) {
+		target := unmarshalMap(t, base)
+		merger := merger{strategies: map[string]MergeStrategy{"broker": FailOnConflict}}
+
+		_, err := merger.merge(target, unmarshalMap(t, "broker:\n  password: secret\n  username: svc\nqueue: jobs\n"), "")
+
+		require.Error(t, err)
+		assert.Equal(t, unmarshalMap(t, base), target)
+	})
+
+	t.Run("should report the parameter that caused a conflict", func(t *testing.T) {
+		provider := newTestProvider(nil)
+		ssmClient := awstest.NewSsm()
+		ssmClient.PutParameter("/app/broker", "svc")
+		provider.ssmClient = ssmClient
+		provider.WithMergeStrategy("broker", FailOnConflict)
+		provider.WithParamStoreTransform("/app/broker", func(from string) (string, error) {
+			return "broker:\n  username: " + from + "\n", nil
+		})
+
+		_, err := provider.includeTransforms(context.Background(), []byte(base))
+
+		assert.EqualError(t, err, "parameter /app/broker conflicts with the config value at broker.username")
+	})
+}
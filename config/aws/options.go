@@ -0,0 +1,125 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Option configures how NewProvider connects to AWS.
+type Option func(*options)
+
+type options struct {
+	endpoint             string
+	credentials          aws.CredentialsProvider
+	roleArn              string
+	retryer              func() aws.Retryer
+	httpClient           config.HTTPClient
+	appConfigDataClient  AppConfigDataClient
+	ssmClient            SsmClient
+	secretsManagerClient SecretsManagerClient
+}
+
+// WithEndpoint sends the requests to all the AWS services to the URL instead of the AWS endpoints, e.g. to
+// a local emulator such as LocalStack.
+func WithEndpoint(url string) Option {
+	return func(options *options) {
+		options.endpoint = url
+	}
+}
+
+// WithCredentials signs the requests with the credentials instead of the ones from the default credential chain.
+func WithCredentials(credentials aws.CredentialsProvider) Option {
+	return func(options *options) {
+		options.credentials = credentials
+	}
+}
+
+// WithAssumeRole assumes the role with STS and signs the requests with its temporary credentials. The role is
+// assumed with the credentials from WithCredentials or from the default credential chain.
+func WithAssumeRole(roleArn string) Option {
+	return func(options *options) {
+		options.roleArn = roleArn
+	}
+}
+
+// WithRetryer replaces the default retryer of the AWS clients, e.g. to change the number of attempts or the backoff.
+func WithRetryer(retryer func() aws.Retryer) Option {
+	return func(options *options) {
+		options.retryer = retryer
+	}
+}
+
+// WithHTTPClient sends the requests with the HTTP client, e.g. to set timeouts or a proxy.
+func WithHTTPClient(client config.HTTPClient) Option {
+	return func(options *options) {
+		options.httpClient = client
+	}
+}
+
+// WithAppConfigDataClient uses the client to read the config from AppConfig instead of creating one.
+func WithAppConfigDataClient(client AppConfigDataClient) Option {
+	return func(options *options) {
+		options.appConfigDataClient = client
+	}
+}
+
+// WithSsmClient uses the client to read parameters from Parameter Store instead of creating one. The client must
+// also implement SsmPathClient to use WithParamStorePath.
+func WithSsmClient(client SsmClient) Option {
+	return func(options *options) {
+		options.ssmClient = client
+	}
+}
+
+// WithSecretsManagerClient uses the client to read secrets from Secrets Manager instead of creating one.
+func WithSecretsManagerClient(client SecretsManagerClient) Option {
+	return func(options *options) {
+		options.secretsManagerClient = client
+	}
+}
+
+// awsConfig loads the AWS config for the region from the default sources, with the options applied.
+func (options *options) awsConfig(ctx context.Context, region string) (aws.Config, error) {
+	loadOptions := []func(*config.LoadOptions) error{
+		config.WithRegion(region),
+	}
+
+	if options.endpoint != "" {
+		loadOptions = append(loadOptions, config.WithEndpointResolverWithOptions(
+			aws.EndpointResolverWithOptionsFunc(func(service, region string, _ ...interface{}) (aws.Endpoint, error) {
+				return aws.Endpoint{
+					URL:               options.endpoint,
+					SigningRegion:     region,
+					HostnameImmutable: true,
+				}, nil
+			}),
+		))
+	}
+
+	if options.credentials != nil {
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(options.credentials))
+	}
+
+	if options.retryer != nil {
+		loadOptions = append(loadOptions, config.WithRetryer(options.retryer))
+	}
+
+	if options.httpClient != nil {
+		loadOptions = append(loadOptions, config.WithHTTPClient(options.httpClient))
+	}
+
+	awsConfig, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	if options.roleArn != "" {
+		awsConfig.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsConfig), options.roleArn))
+	}
+
+	return awsConfig, nil
+}
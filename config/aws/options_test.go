@@ -0,0 +1,104 @@
+package aws
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config/aws/awstest"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+// recordingServer fails every request and records the path and body of the requests it receives.
+type recordingServer struct {
+	mutex    sync.Mutex
+	requests []string
+}
+
+func (server *recordingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	server.mutex.Lock()
+	server.requests = append(server.requests, r.URL.Path+" "+string(body))
+	server.mutex.Unlock()
+
+	w.WriteHeader(http.StatusBadRequest)
+}
+
+func TestNewProvider(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	ctx := context.Background()
+
+	t.Run("should use the injected clients", func(t *testing.T) {
+		appConfig := awstest.NewAppConfigData()
+		appConfig.Publish("app", "env", "profile", "broker-addr: ${ssm:/app/broker}\n")
+
+		ssmClient := awstest.NewSsm()
+		ssmClient.PutSecureString("/app/broker", "amqp://broker")
+
+		provider, err := NewProvider[*watchConfig]("us-west-2", "app", "profile", "env",
+			WithAppConfigDataClient(appConfig),
+			WithSsmClient(ssmClient),
+			WithSecretsManagerClient(awstest.NewSecretsManager()),
+		)
+		require.NoError(t, err)
+
+		cfg := &watchConfig{}
+		err = provider.GetConfig(ctx, cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, "amqp://broker", cfg.BrokerAddr)
+	})
+
+	t.Run("should send the requests to the endpoint", func(t *testing.T) {
+		// the SDK can't add a custom CA bundle to a plain http.Client
+		t.Setenv("AWS_CA_BUNDLE", "")
+
+		recorder := &recordingServer{}
+		server := httptest.NewServer(recorder)
+		defer server.Close()
+
+		provider, err := NewProvider[*watchConfig]("us-west-2", "app", "profile", "env",
+			WithEndpoint(server.URL),
+			WithCredentials(credentials.NewStaticCredentialsProvider("key", "secret", "")),
+			WithRetryer(func() aws.Retryer { return aws.NopRetryer{} }),
+			WithHTTPClient(server.Client()),
+		)
+		require.NoError(t, err)
+
+		err = provider.GetConfig(ctx, &watchConfig{})
+
+		require.Error(t, err)
+		require.Len(t, recorder.requests, 1)
+		assert.Contains(t, recorder.requests[0], "/configurationsessions")
+	})
+
+	t.Run("should assume the role", func(t *testing.T) {
+		recorder := &recordingServer{}
+		server := httptest.NewServer(recorder)
+		defer server.Close()
+
+		provider, err := NewProvider[*watchConfig]("us-west-2", "app", "profile", "env",
+			WithEndpoint(server.URL),
+			WithCredentials(credentials.NewStaticCredentialsProvider("key", "secret", "")),
+			WithAssumeRole("arn:aws:iam::123456789012:role/config-reader"),
+			WithRetryer(func() aws.Retryer { return aws.NopRetryer{} }),
+		)
+		require.NoError(t, err)
+
+		err = provider.GetConfig(ctx, &watchConfig{})
+
+		require.Error(t, err)
+		require.NotEmpty(t, recorder.requests)
+		assert.Contains(t, recorder.requests[0], "Action=AssumeRole")
+		assert.Contains(t, recorder.requests[0], "config-reader")
+	})
+}
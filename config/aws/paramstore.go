@@ -0,0 +1,194 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go/ptr"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxParametersPerCall is the maximum number of names that GetParameters accepts.
+	maxParametersPerCall = 10
+
+	// maxConcurrentCalls limits the GetParameters calls in flight to stay clear of the Parameter Store
+	// throughput quota.
+	maxConcurrentCalls = 4
+
+	// maxResultsPerPage is the maximum number of parameters that GetParametersByPath returns per page.
+	maxResultsPerPage = 10
+)
+
+// getParameters gets the decrypted parameters in batches of maxParametersPerCall names, with at most
+// maxConcurrentCalls batches in flight. The parameters and the invalid parameters are returned in the order
+// of the names.
+func getParameters(ctx context.Context, client SsmClient, names []string) ([]types.Parameter, []string, error) {
+	var batches [][]string
+	for start := 0; start < len(names); start += maxParametersPerCall {
+		end := start + maxParametersPerCall
+		if end > len(names) {
+			end = len(names)
+		}
+
+		batches = append(batches, names[start:end])
+	}
+
+	outputs := make([]*ssm.GetParametersOutput, len(batches))
+	errs := make([]error, len(batches))
+
+	semaphore := make(chan struct{}, maxConcurrentCalls)
+	wg := sync.WaitGroup{}
+
+	for i, batch := range batches {
+		wg.Add(1)
+
+		go func(i int, batch []string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			outputs[i], errs[i] = client.GetParameters(ctx, &ssm.GetParametersInput{
+				Names:          batch,
+				WithDecryption: ptr.Bool(true),
+			})
+		}(i, batch)
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		params        []types.Parameter
+		invalidParams []string
+	)
+
+	for _, output := range outputs {
+		params = append(params, output.Parameters...)
+		invalidParams = append(invalidParams, output.InvalidParameters...)
+	}
+
+	return params, invalidParams, nil
+}
+
+// SsmPathClient is an SsmClient that can also get the parameters under a path, which WithParamStorePath requires.
+// The client created by NewProvider implements it.
+type SsmPathClient interface {
+	SsmClient
+	GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
+}
+
+var _ SsmPathClient = &ssm.Client{}
+
+// getParametersByPath gets all the decrypted parameters under the path, recursively, page by page.
+func getParametersByPath(ctx context.Context, client SsmClient, path string) ([]types.Parameter, error) {
+	pathClient, ok := client.(SsmPathClient)
+	if !ok {
+		return nil, fmt.Errorf("the Parameter Store client %T does not implement GetParametersByPath", client)
+	}
+
+	var (
+		params    []types.Parameter
+		nextToken *string
+	)
+
+	for {
+		output, err := pathClient.GetParametersByPath(ctx, &ssm.GetParametersByPathInput{
+			Path:           &path,
+			Recursive:      ptr.Bool(true),
+			WithDecryption: ptr.Bool(true),
+			MaxResults:     ptr.Int32(maxResultsPerPage),
+			NextToken:      nextToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, output.Parameters...)
+
+		if output.NextToken == nil || *output.NextToken == "" {
+			return params, nil
+		}
+
+		nextToken = output.NextToken
+	}
+}
+
+// nestParameters maps the parameters under the path onto nested keys, e.g. /app/prod/db/password with the path
+// /app/prod onto {"db": {"password": value}}. The values are typed with typedValue. It fails if a parameter is
+// both a value and the parent of other parameters, e.g. /app/prod/db and /app/prod/db/password.
+func nestParameters(path string, params []types.Parameter) (map[string]any, error) {
+	result := map[string]any{}
+	prefix := strings.TrimSuffix(path, "/") + "/"
+
+	for _, param := range params {
+		if param.Name == nil || param.Value == nil {
+			continue
+		}
+
+		keys := strings.Split(strings.Trim(strings.TrimPrefix(*param.Name, prefix), "/"), "/")
+
+		var value any = typedValue(*param.Value)
+		if param.Type == types.ParameterTypeStringList {
+			list := []any{}
+			for _, item := range strings.Split(*param.Value, ",") {
+				list = append(list, typedValue(item))
+			}
+
+			value = list
+		}
+
+		current := result
+		for i, key := range keys[:len(keys)-1] {
+			next, ok := current[key].(map[string]any)
+			if !ok {
+				if _, exists := current[key]; exists {
+					return nil, fmt.Errorf("parameter %s is both a value and the parent of other parameters", prefix+strings.Join(keys[:i+1], "/"))
+				}
+
+				next = map[string]any{}
+				current[key] = next
+			}
+
+			current = next
+		}
+
+		leaf := keys[len(keys)-1]
+		if _, isParent := current[leaf].(map[string]any); isParent {
+			return nil, fmt.Errorf("parameter %s is both a value and the parent of other parameters", *param.Name)
+		}
+
+		current[leaf] = value
+	}
+
+	return result, nil
+}
+
+// typedValue returns the value typed like a plain YAML scalar when it is a bool or a number that reads back the
+// same, e.g. true or 5432, so that it can be unmarshalled into fields of those types. Any other value is
+// returned as a string, e.g. 007700, which YAML would read as an octal number, or null.
+func typedValue(raw string) any {
+	var value any
+	if err := (&yaml.Node{Kind: yaml.ScalarNode, Value: raw}).Decode(&value); err != nil {
+		return raw
+	}
+
+	switch value.(type) {
+	case bool, int, uint64, float64:
+		encoded, err := yaml.Marshal(value)
+		if err == nil && strings.TrimSpace(string(encoded)) == raw {
+			return value
+		}
+	}
+
+	return raw
+}
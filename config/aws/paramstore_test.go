@@ -0,0 +1,138 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go/ptr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config/aws/awstest"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParamStore(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	ctx := context.Background()
+
+	t.Run("should get parameters in batches", func(t *testing.T) {
+		client := awstest.NewSsm()
+
+		var names []string
+		for i := 0; i < 25; i++ {
+			name := fmt.Sprintf("/app/secret-%02d", i)
+			names = append(names, name)
+
+			if i != 7 {
+				client.PutSecureString(name, strconv.Itoa(i))
+			}
+		}
+
+		params, invalidParams, err := getParameters(ctx, client, names)
+
+		require.NoError(t, err)
+		assert.Len(t, params, 24)
+		assert.Equal(t, []string{"/app/secret-07"}, invalidParams)
+
+		var callSizes []int
+		for _, call := range client.GetParametersCalls() {
+			callSizes = append(callSizes, len(call))
+		}
+
+		assert.ElementsMatch(t, []int{10, 10, 5}, callSizes)
+	})
+
+	t.Run("should map parameters under a path onto nested keys", func(t *testing.T) {
+		client := awstest.NewSsm()
+		client.PutSecureString("/app/prod/broker-addr", "amqp://broker")
+		client.PutSecureString("/app/prod/db/username", "svc")
+		client.PutSecureString("/app/prod/db/password", "hunter2")
+		client.PutStringList("/app/prod/db/hosts", "db1", "db2")
+		client.PutSecureString("/app/prod/cache/ttl", "60")
+		client.PutSecureString("/app/prod/cache/size", "100")
+		client.PutSecureString("/app/prod/mail/from", "noreply")
+		client.PutSecureString("/app/prod/mail/smtp/host", "smtp.local")
+		client.PutSecureString("/app/prod/mail/smtp/port", "25")
+		client.PutSecureString("/app/prod/mail/smtp/tls", "true")
+		client.PutSecureString("/app/prod/mail/smtp/user", "mailer")
+		client.PutSecureString("/app/prod/mail/smtp/token", "007700")
+		client.PutSecureString("/app/staging/db/password", "staging")
+
+		provider := newTestProvider(nil)
+		provider.ssmClient = client
+		provider.WithParamStorePath("/app/prod")
+
+		content, err := provider.includeTransforms(ctx, []byte("broker-addr: amqp://localhost\nworkers: 2\ndb:\n  port: 5432\n"))
+		require.NoError(t, err)
+
+		merged := unmarshalMap(t, string(content))
+		assert.Equal(t, "amqp://broker", merged["broker-addr"])
+		assert.Equal(t, map[string]any{
+			"username": "svc",
+			"password": "hunter2",
+			"hosts":    []any{"db1", "db2"},
+			"port":     5432,
+		}, merged["db"])
+		assert.Equal(t, map[string]any{"ttl": 60, "size": 100}, merged["cache"])
+		assert.Equal(t, map[string]any{
+			"host":  "smtp.local",
+			"port":  25,
+			"tls":   true,
+			"user":  "mailer",
+			"token": "007700",
+		}, merged["mail"].(map[string]any)["smtp"])
+
+		smtp := struct {
+			Mail struct {
+				Smtp struct {
+					Port  int    `yaml:"port"`
+					Tls   bool   `yaml:"tls"`
+					Token string `yaml:"token"`
+				} `yaml:"smtp"`
+			} `yaml:"mail"`
+		}{}
+		require.NoError(t, yaml.Unmarshal(content, &smtp))
+		assert.Equal(t, 25, smtp.Mail.Smtp.Port)
+		assert.True(t, smtp.Mail.Smtp.Tls)
+		assert.Equal(t, "007700", smtp.Mail.Smtp.Token)
+	})
+
+	t.Run("should fail when a parameter is both a value and a parent", func(t *testing.T) {
+		client := awstest.NewSsm()
+		client.PutSecureString("/app/prod/db", "postgres://db")
+		client.PutSecureString("/app/prod/db/password", "hunter2")
+
+		provider := newTestProvider(nil)
+		provider.ssmClient = client
+		provider.WithParamStorePath("/app/prod")
+
+		_, err := provider.includeTransforms(ctx, []byte("workers: 2\n"))
+		assert.EqualError(t, err, "parameter /app/prod/db is both a value and the parent of other parameters")
+
+		params := []types.Parameter{
+			{Name: ptr.String("/app/prod/db/password"), Value: ptr.String("hunter2")},
+			{Name: ptr.String("/app/prod/db"), Value: ptr.String("postgres://db")},
+		}
+
+		_, err = nestParameters("/app/prod", params)
+		assert.EqualError(t, err, "parameter /app/prod/db is both a value and the parent of other parameters")
+
+		_, err = nestParameters("/app/prod", []types.Parameter{params[1], params[0]})
+		assert.EqualError(t, err, "parameter /app/prod/db is both a value and the parent of other parameters")
+	})
+
+	t.Run("should fail to load a path with a client that can't get parameters by path", func(t *testing.T) {
+		provider := newTestProvider(nil)
+		provider.ssmClient = struct{ SsmClient }{awstest.NewSsm()}
+		provider.WithParamStorePath("/app/prod")
+
+		_, err := provider.includeTransforms(ctx, []byte("workers: 2\n"))
+
+		assert.ErrorContains(t, err, "does not implement GetParametersByPath")
+	})
+}
@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"sync/atomic"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/appconfigdata"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
-	"github.com/aws/smithy-go/ptr"
 	"github.com/ilyakaznacheev/cleanenv"
 	"gopkg.in/yaml.v3"
 
@@ -24,15 +26,34 @@ const (
 	Env         = "APPCONFIG_ENV"
 )
 
+const defaultPollInterval int32 = 60
+
 type Provider[T goutilsconfig.Config] struct {
 	application          string
 	configProfile        string
 	env                  string
 	appConfigDataClient  AppConfigDataClient
 	ssmClient            SsmClient
+	secretsManagerClient SecretsManagerClient
+	secretsStage         string
 	paramStoreTransforms map[string]func(from string) (string, error)
+	paramStorePaths      []string
+	strictParamStore     bool
+	mergeStrategies      map[string]MergeStrategy
+	resolvers            *goutilsconfig.Resolvers
+	pollInterval         int32
+	current              atomic.Pointer[T]
+	after                func(d time.Duration) <-chan time.Time
+	cache                *configCache
+	status               atomic.Pointer[Status]
+	watching             atomic.Bool
 }
 
+var (
+	_ goutilsconfig.Watcher[goutilsconfig.Config]      = &Provider[goutilsconfig.Config]{}
+	_ goutilsconfig.SourceLoader[goutilsconfig.Config] = &Provider[goutilsconfig.Config]{}
+)
+
 type AppConfigDataClient interface {
 	StartConfigurationSession(ctx context.Context, params *appconfigdata.StartConfigurationSessionInput, optFns ...func(*appconfigdata.Options)) (*appconfigdata.StartConfigurationSessionOutput, error)
 	GetLatestConfiguration(ctx context.Context, params *appconfigdata.GetLatestConfigurationInput, optFns ...func(*appconfigdata.Options)) (*appconfigdata.GetLatestConfigurationOutput, error)
@@ -48,12 +69,13 @@ type SsmClient interface {
 //   - application - the name of the AppConfig application
 //   - profile - the name of the profile in the AppConfig application
 //   - env - the name of the environment in the AppConfig application
-//   - secretNames - the names of the secrets from Parameter Store to load and merge with the config in AppConfig
+//   - opts - options to change how the provider connects to AWS, e.g. WithEndpoint or WithAssumeRole
 func NewProvider[T goutilsconfig.Config](
 	region,
 	application,
 	profile,
-	env string) (*Provider[T], error) {
+	env string,
+	opts ...Option) (*Provider[T], error) {
 
 	var zero Provider[T]
 
@@ -61,25 +83,53 @@ func NewProvider[T goutilsconfig.Config](
 		return &zero, errors.New("region, application, profile, clientId and/or env was not provided -- check your environment variables")
 	}
 
-	awsConfig, err := config.LoadDefaultConfig(context.Background(),
-		config.WithRegion(region),
-	)
-
-	if err != nil {
-		return nil, err
+	options := &options{}
+	for _, opt := range opts {
+		opt(options)
 	}
 
-	appConfigDataClient := appconfigdata.NewFromConfig(awsConfig)
-	ssmClient := ssm.NewFromConfig(awsConfig)
+	appConfigDataClient := options.appConfigDataClient
+	ssmClient := options.ssmClient
+	secretsManagerClient := options.secretsManagerClient
 
-	return &Provider[T]{
+	if appConfigDataClient == nil || ssmClient == nil || secretsManagerClient == nil {
+		awsConfig, err := options.awsConfig(context.Background(), region)
+		if err != nil {
+			return nil, err
+		}
+
+		if appConfigDataClient == nil {
+			appConfigDataClient = appconfigdata.NewFromConfig(awsConfig)
+		}
+
+		if ssmClient == nil {
+			ssmClient = ssm.NewFromConfig(awsConfig)
+		}
+
+		if secretsManagerClient == nil {
+			secretsManagerClient = secretsmanager.NewFromConfig(awsConfig)
+		}
+	}
+
+	provider := &Provider[T]{
 		application:          application,
 		configProfile:        profile,
 		env:                  env,
 		appConfigDataClient:  appConfigDataClient,
 		ssmClient:            ssmClient,
+		secretsManagerClient: secretsManagerClient,
+		secretsStage:         StageCurrent,
 		paramStoreTransforms: map[string]func(from string) (string, error){},
-	}, nil
+		mergeStrategies:      map[string]MergeStrategy{},
+		resolvers:            &goutilsconfig.Resolvers{},
+		pollInterval:         defaultPollInterval,
+		after:                time.After,
+	}
+
+	provider.resolvers.Register("ssm", NewSsmResolver(ssmClient))
+	provider.resolvers.Register("secretsmanager", goutilsconfig.ResolverFunc(provider.resolveSecrets))
+
+	return provider, nil
 }
 
 // MustGetEnvs grabs all the needed vars from the running environment to be able to create a new Provider with NewProvider().
@@ -113,10 +163,133 @@ func (provider *Provider[T]) WithParamStoreTransform(key string, transform func(
 	provider.paramStoreTransforms[key] = transform
 }
 
+// WithResolver registers a resolver for the placeholders of the scheme in the AppConfig content, in addition to
+// the ${ssm:/name} and ${secretsmanager:name} placeholders that are always resolved. The ${env:NAME} and
+// ${file:/path} placeholders are not resolved unless enabled, since they let whoever deploys the AppConfig content
+// read local environment variables and files into the config:
+//
+//	provider.WithResolver("env", goutilsconfig.EnvResolver)
+func (provider *Provider[T]) WithResolver(scheme string, resolver goutilsconfig.Resolver) {
+	if provider.resolvers == nil {
+		provider.resolvers = &goutilsconfig.Resolvers{}
+	}
+
+	provider.resolvers.Register(scheme, resolver)
+}
+
+// WithSecretsVersionStage sets the version stage of the Secrets Manager secrets bound onto the config fields
+// tagged with `secret:"name#jsonKey"` and of the ${secretsmanager:name} placeholders, e.g. StagePending.
+// The default is StageCurrent.
+func (provider *Provider[T]) WithSecretsVersionStage(stage string) {
+	provider.secretsStage = stage
+}
+
+// resolveSecrets resolves the ${secretsmanager:name} placeholders in the version stage set when they are resolved
+// rather than when the provider was created, so that WithSecretsVersionStage applies to them.
+func (provider *Provider[T]) resolveSecrets(ctx context.Context, refs []string) (map[string]string, error) {
+	return NewSecretsManagerResolver(provider.secretsManagerClient, provider.secretsStage).Resolve(ctx, refs)
+}
+
+// WithStrictParamStore fails GetConfig and Watch when a parameter with a transform doesn't exist or can't be
+// transformed. By default, such parameters are logged and skipped, so that optional parameters can be left out.
+func (provider *Provider[T]) WithStrictParamStore() {
+	provider.strictParamStore = true
+}
+
+// WithParamStorePath loads all the parameters under the Parameter Store path, recursively, and merges them into
+// the config with the rest of the path as nested keys. For example, with the path /app/prod, the parameter
+// /app/prod/db/password sets the "password" key of the "db" key. StringList parameters are loaded as lists.
+// Values that are booleans or numbers, e.g. true or 5432, can be loaded into fields of those types. The
+// Parameter Store client must implement SsmPathClient.
+func (provider *Provider[T]) WithParamStorePath(path string) {
+	provider.paramStorePaths = append(provider.paramStorePaths, path)
+}
+
+// WithMergeStrategy sets how the transformed Parameter Store values are merged into the config at the given
+// path of YAML keys, e.g. "broker" or "broker.hosts". The strategy also applies to the values below the path
+// unless they have a strategy of their own. By default, maps are merged recursively and other values replaced.
+func (provider *Provider[T]) WithMergeStrategy(path string, strategy MergeStrategy) {
+	if provider.mergeStrategies == nil {
+		provider.mergeStrategies = map[string]MergeStrategy{}
+	}
+
+	provider.mergeStrategies[path] = strategy
+}
+
+// WithPollInterval sets the minimum interval in seconds at which AppConfig may be polled for changes by Watch.
+// AppConfig does not accept intervals lower than 15 seconds. The default is 60 seconds.
+func (provider *Provider[T]) WithPollInterval(seconds int32) {
+	provider.pollInterval = seconds
+}
+
+// GetConfig loads the config from AppConfig merged with the Parameter Store secrets on top of the environment
+// variables into cfg and validates it. Parameters that can't be loaded and validation errors are all reported
+// in the returned error, unless the config is loaded from the last-known-good cache set with WithLastKnownGood.
 func (provider *Provider[T]) GetConfig(ctx context.Context, cfg T) error {
-	log := goutilslog.FromContext(ctx)
+	output, err := provider.fetch(ctx)
+	if err == nil {
+		err = provider.decodeAndValidate(ctx, output.Configuration, cfg)
+	}
+
+	if err != nil {
+		return provider.fallback(ctx, cfg, err)
+	}
+
+	provider.remember(ctx, cfg)
+
+	return nil
+}
+
+// LoadSource loads the config from AppConfig merged with the Parameter Store secrets, without the
+// environment variables, so that it can be layered with config.Layered. It returns the paths of the fields
+// whose keys are in the merged config and of the fields bound to Secrets Manager secrets.
+func (provider *Provider[T]) LoadSource(ctx context.Context, cfg T) ([]string, error) {
+	output, err := provider.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := provider.unmarshal(ctx, output.Configuration, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := goutilsconfig.YAMLPaths(cfg, merged)
+	if err != nil || provider.secretsManagerClient == nil {
+		return paths, err
+	}
 
-	var pollInterval int32 = 60
+	secretPaths, err := goutilsconfig.SecretPaths(cfg)
+
+	return append(paths, secretPaths...), err
+}
+
+// fetch gets the config content from a new AppConfig session, along with the token and interval of its next poll.
+func (provider *Provider[T]) fetch(ctx context.Context) (*appconfigdata.GetLatestConfigurationOutput, error) {
+	token, err := provider.startSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	getLatestOutput, err := provider.appConfigDataClient.GetLatestConfiguration(ctx, &appconfigdata.GetLatestConfigurationInput{
+		ConfigurationToken: token,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	goutilslog.FromContext(ctx).Infof("Config loaded from AppConfig")
+
+	return getLatestOutput, nil
+}
+
+// startSession starts a new AppConfig configuration session and returns its initial token.
+func (provider *Provider[T]) startSession(ctx context.Context) (*string, error) {
+	pollInterval := provider.pollInterval
+	if pollInterval == 0 {
+		pollInterval = defaultPollInterval
+	}
 
 	startInput := &appconfigdata.StartConfigurationSessionInput{
 		ApplicationIdentifier:                &provider.application,
@@ -125,47 +298,72 @@ func (provider *Provider[T]) GetConfig(ctx context.Context, cfg T) error {
 		RequiredMinimumPollIntervalInSeconds: &pollInterval,
 	}
 
-	log.Infow("Loading config from AWS", "awsConfigInput", startInput)
+	goutilslog.FromContext(ctx).Infow("Loading config from AWS", "awsConfigInput", startInput)
 
 	startOutput, err := provider.appConfigDataClient.StartConfigurationSession(ctx, startInput)
-
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	getLatestInput := &appconfigdata.GetLatestConfigurationInput{
-		ConfigurationToken: startOutput.InitialConfigurationToken,
-	}
+	return startOutput.InitialConfigurationToken, nil
+}
 
-	getLatestOutput, err := provider.appConfigDataClient.GetLatestConfiguration(ctx, getLatestInput)
+// decodeAndValidate decodes the content into cfg and validates it. All the errors are joined into one.
+func (provider *Provider[T]) decodeAndValidate(ctx context.Context, content []byte, cfg T) error {
+	return errors.Join(provider.decode(ctx, content, cfg), cfg.Validate())
+}
 
-	if err != nil {
-		return err
-	}
+// decode loads the content merged with the Parameter Store secrets on top of the environment variables into cfg.
+func (provider *Provider[T]) decode(ctx context.Context, content []byte, cfg T) error {
+	// Load environment variables
+	cleanenv.ReadEnv(cfg)
 
-	log.Infof("Config loaded from AppConfig")
+	_, err := provider.unmarshal(ctx, content, cfg)
 
-	rawConfig, err := provider.includeTransforms(ctx, getLatestOutput.Configuration)
+	return err
+}
+
+// unmarshal resolves the placeholders in the content, merges the Parameter Store secrets into it, unmarshals
+// the result into cfg and binds the Secrets Manager secrets. It returns the merged content.
+func (provider *Provider[T]) unmarshal(ctx context.Context, content []byte, cfg T) ([]byte, error) {
+	resolvers := provider.resolvers
+	if resolvers == nil {
+		resolvers = &goutilsconfig.Resolvers{}
+	}
+
+	content, err := resolvers.Resolve(ctx, content)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to resolve placeholders in AppConfig: %w", err)
 	}
 
-	// Load environment variables
-	cleanenv.ReadEnv(cfg)
+	rawConfig, transformErr := provider.includeTransforms(ctx, content)
+	if rawConfig == nil {
+		return nil, transformErr
+	}
 
 	err = yaml.Unmarshal(rawConfig, &cfg)
 	if err != nil {
-		panic("toConfig: error unmarshalling config from bytes")
+		return nil, errors.Join(transformErr, fmt.Errorf("error unmarshalling config from AppConfig: %w", err))
 	}
 
-	return nil
+	if provider.secretsManagerClient == nil {
+		return rawConfig, transformErr
+	}
+
+	secretsErr := goutilsconfig.BindSecrets(ctx, cfg, goutilsconfig.ResolverFunc(provider.resolveSecrets))
+
+	return rawConfig, errors.Join(transformErr, secretsErr)
 }
 
+// includeTransforms merges the transformed Parameter Store values and the Parameter Store hierarchies into the
+// base config. Parameters that can't be loaded, transformed or merged are skipped and their errors joined in the
+// returned error, along with the config merged with the other parameters. The config is nil only if the base
+// config can't be unmarshalled.
 func (provider *Provider[T]) includeTransforms(ctx context.Context, baseConfig []byte) ([]byte, error) {
 	log := goutilslog.FromContext(ctx)
 
-	if len(provider.paramStoreTransforms) == 0 {
-		log.Info("No secrets were loaded because no Parameter Store transforms were given")
+	if len(provider.paramStoreTransforms) == 0 && len(provider.paramStorePaths) == 0 {
+		log.Info("No secrets were loaded because no Parameter Store transforms or paths were given")
 		return baseConfig, nil
 	}
 
@@ -177,27 +375,56 @@ func (provider *Provider[T]) includeTransforms(ctx context.Context, baseConfig [
 		return nil, err
 	}
 
+	merger := merger{strategies: provider.mergeStrategies}
+
+	errs := provider.mergeTransformed(ctx, merger, configMap)
+
+	for _, path := range provider.paramStorePaths {
+		errs = append(errs, provider.mergePath(ctx, merger, configMap, path))
+	}
+
+	mergedResult, err := yaml.Marshal(configMap)
+	if err != nil {
+		log.Error("Failed to unmarshal merged config")
+		return nil, err
+	}
+
+	return mergedResult, errors.Join(errs...)
+}
+
+// mergeTransformed merges the values of the parameters with a transform into the config map and returns the
+// errors of the parameters that couldn't be merged. Missing parameters and failed transforms are only logged
+// unless WithStrictParamStore is set.
+func (provider *Provider[T]) mergeTransformed(ctx context.Context, merger merger, configMap map[string]any) []error {
+	log := goutilslog.FromContext(ctx)
+
+	if len(provider.paramStoreTransforms) == 0 {
+		return nil
+	}
+
 	var secretNames []string
 	for key := range provider.paramStoreTransforms {
 		secretNames = append(secretNames, key)
 	}
 
-	getInput := &ssm.GetParametersInput{
-		Names:          secretNames,
-		WithDecryption: ptr.Bool(true),
-	}
-
-	getOutput, err := provider.ssmClient.GetParameters(ctx, getInput)
+	sort.Strings(secretNames)
 
+	params, invalidParams, err := getParameters(ctx, provider.ssmClient, secretNames)
 	if err != nil {
-		return nil, err
+		log.Errorw("Failed to get secrets from Parameter Store", "error", err)
+		return []error{fmt.Errorf("failed to get parameters: %w", err)}
 	}
 
-	for _, param := range getOutput.Parameters {
+	var errs []error
+
+	for _, param := range params {
 		if param.Value != nil {
 			transformed, err := provider.paramStoreTransforms[*param.Name](*param.Value)
 			if err != nil {
 				log.Errorw(fmt.Sprintf("Failed to transform secret %s", *param.Name), "error", err)
+				if provider.strictParamStore {
+					errs = append(errs, fmt.Errorf("failed to transform parameter %s: %w", *param.Name, err))
+				}
 				continue
 			}
 
@@ -205,33 +432,75 @@ func (provider *Provider[T]) includeTransforms(ctx context.Context, baseConfig [
 
 			err = yaml.Unmarshal([]byte(transformed), secretsMap)
 			if err != nil {
-				log.Errorw("Failed to unmarshal secret from Parameter Store: %s", *param.Name)
-				return nil, err
+				log.Errorw("Failed to unmarshal secret from Parameter Store", "parameter", *param.Name, "error", err)
+				errs = append(errs, fmt.Errorf("failed to unmarshal transformed parameter %s: %w", *param.Name, err))
+				continue
 			}
 
-			mergeMaps(configMap, secretsMap)
+			if err := mergeParameter(ctx, merger, configMap, secretsMap, *param.Name); err != nil {
+				errs = append(errs, err)
+				continue
+			}
 
 			log.Infof("Merged secret from Parameter Store: %s", *param.Name)
 		}
 	}
 
-	for _, param := range getOutput.InvalidParameters {
+	for _, param := range invalidParams {
 		log.Warnf("Invalid secret parameter could not be loaded: %s", param)
+		if provider.strictParamStore {
+			errs = append(errs, fmt.Errorf("invalid parameter %s could not be loaded", param))
+		}
 	}
 
-	mergedResult, err := yaml.Marshal(configMap)
+	return errs
+}
+
+// mergePath merges the parameters under the Parameter Store path into the config map.
+func (provider *Provider[T]) mergePath(ctx context.Context, merger merger, configMap map[string]any, path string) error {
+	log := goutilslog.FromContext(ctx)
+
+	params, err := getParametersByPath(ctx, provider.ssmClient, path)
 	if err != nil {
-		log.Error("Failed to unmarshal merged config")
-		return nil, err
+		log.Errorw("Failed to get secrets from Parameter Store path", "path", path, "error", err)
+		return fmt.Errorf("failed to get parameters by path %s: %w", path, err)
 	}
 
-	return mergedResult, nil
+	values, err := nestParameters(path, params)
+	if err != nil {
+		log.Errorw("Failed to nest secrets from Parameter Store path", "path", path, "error", err)
+		return err
+	}
+
+	if err := mergeParameter(ctx, merger, configMap, values, path); err != nil {
+		return err
+	}
+
+	log.Infow("Merged secrets from Parameter Store path", "path", path, "count", len(params))
+
+	return nil
 }
 
-// mergeMaps performs a top-level merge replacing or adding any fields from source and applying it to target.
-// Only the target is modified.
-func mergeMaps(target map[string]any, source map[string]any) {
-	for sourceKey, sourceValue := range source {
-		target[sourceKey] = sourceValue
+// mergeParameter merges the values from the parameter, or the path, into the config map and warns about the
+// config values that they override.
+func mergeParameter(ctx context.Context, merger merger, configMap map[string]any, values map[string]any, name string) error {
+	log := goutilslog.FromContext(ctx)
+
+	overridden, err := merger.merge(configMap, values, "")
+	if err != nil {
+		var conflictErr *MergeConflictError
+		if errors.As(err, &conflictErr) {
+			conflictErr.Parameter = name
+		}
+
+		log.Errorw("Failed to merge secret from Parameter Store", "parameter", name, "error", err)
+
+		return err
 	}
+
+	for _, path := range overridden {
+		log.Warnw("Secret from Parameter Store overrides a config value", "parameter", name, "path", path)
+	}
+
+	return nil
 }
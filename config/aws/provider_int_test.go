@@ -2,21 +2,21 @@ package aws
 
 import (
 	"context"
-	"fmt"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	goutilsconfig "gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config"
 	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
 )
 
 type TestConfig struct {
 	BrokerAddr     string `yaml:"broker-addr" env:"BROKER_ADDR" env-default:"amqp://localhost:5672"`
 	BrokerUsername string `yaml:"broker-username" env:"BROKER_USERNAME" env-default:"admin"`
-	BrokerPassword string `yaml:"broker-password" env:"BROKER_PASSWORD" env-default:""`
+	BrokerPassword string `yaml:"broker-password" env:"BROKER_PASSWORD" env-default:"" secret:"true"`
 	MongoURL       string `yaml:"mongo-url" env:"MONGO_URL" env-default:"mongodb://localhost:27024"`
 	MongoUser      string `yaml:"mongo-user" env:"MONGO_USER" env-default:"admin"`
-	MongoPassword  string `yaml:"mongo-password" env:"MONGO_PASSWORD" env-default:""`
+	MongoPassword  string `yaml:"mongo-password" env:"MONGO_PASSWORD" env-default:"" secret:"true"`
 }
 
 func (c *TestConfig) Validate() error {
@@ -24,18 +24,7 @@ func (c *TestConfig) Validate() error {
 }
 
 func (c *TestConfig) Strings() []string {
-	var builder []string
-
-	builder = append(builder,
-		fmt.Sprintf("BrokerAddr: %s", c.BrokerAddr),
-		fmt.Sprintf("BrokerUsername: %s", c.BrokerUsername),
-		fmt.Sprintf("BrokerPassword: %s", "*****"), // intentionally scrubbed
-		fmt.Sprintf("MongoURL: %s", c.MongoURL),
-		fmt.Sprintf("MongoUser: %s", c.MongoUser),
-		fmt.Sprintf("MongoPassword: %s", "*****"), // intentionally scrubbed
-	)
-
-	return builder
+	return goutilsconfig.Describe(c)
 }
 
 func TestAwsAppConfig(t *testing.T) {
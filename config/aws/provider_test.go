@@ -0,0 +1,424 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	goutilsconfig "gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config/aws/awstest"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+type watchConfig struct {
+	BrokerAddr string `yaml:"broker-addr"`
+	Workers    int    `yaml:"workers"`
+}
+
+func (c *watchConfig) Validate() error {
+	if c.BrokerAddr == "" {
+		return errors.New("broker-addr is required")
+	}
+
+	return nil
+}
+
+func (c *watchConfig) Strings() []string {
+	return []string{fmt.Sprintf("BrokerAddr: %s", c.BrokerAddr), fmt.Sprintf("Workers: %d", c.Workers)}
+}
+
+func newTestAppConfigData(content string) *awstest.AppConfigData {
+	client := awstest.NewAppConfigData()
+	client.Publish("app", "env", "profile", content)
+
+	return client
+}
+
+func newTestProvider(client AppConfigDataClient) *Provider[*watchConfig] {
+	return &Provider[*watchConfig]{
+		application:          "app",
+		configProfile:        "profile",
+		env:                  "env",
+		appConfigDataClient:  client,
+		paramStoreTransforms: map[string]func(from string) (string, error){},
+		pollInterval:         defaultPollInterval,
+		after: func(d time.Duration) <-chan time.Time {
+			if fake, ok := client.(*awstest.AppConfigData); ok {
+				fake.Advance(d)
+			}
+
+			return time.After(time.Millisecond)
+		},
+	}
+}
+
+// signalPolls makes the provider wait for the test to receive from the returned channel before each poll.
+func signalPolls(ctx context.Context, provider *Provider[*watchConfig]) <-chan struct{} {
+	polls := make(chan struct{})
+	after := provider.after
+
+	provider.after = func(d time.Duration) <-chan time.Time {
+		select {
+		case polls <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		return after(d)
+	}
+
+	return polls
+}
+
+func TestWatch(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	t.Run("should swap in changed config and notify with old and new values", func(t *testing.T) {
+		client := newTestAppConfigData("broker-addr: amqp://one\nworkers: 1\n")
+		provider := newTestProvider(client)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		changes := make(chan [2]*watchConfig, 1)
+		err := provider.Watch(ctx, func(old *watchConfig, new *watchConfig) {
+			changes <- [2]*watchConfig{old, new}
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "amqp://one", provider.Current().BrokerAddr)
+
+		client.Publish("app", "env", "profile", "broker-addr: amqp://two\nworkers: 2\n")
+
+		select {
+		case change := <-changes:
+			assert.Equal(t, "amqp://one", change[0].BrokerAddr)
+			assert.Equal(t, "amqp://two", change[1].BrokerAddr)
+			assert.Equal(t, 2, provider.Current().Workers)
+		case <-time.After(time.Second):
+			require.Fail(t, "config change was not notified")
+		}
+
+		assert.Equal(t, 1, client.Sessions())
+	})
+
+	t.Run("should keep the current config when the new config is invalid", func(t *testing.T) {
+		client := newTestAppConfigData("broker-addr: amqp://one\n")
+		provider := newTestProvider(client)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		polls := signalPolls(ctx, provider)
+
+		changes := make(chan *watchConfig, 2)
+		err := provider.Watch(ctx, func(old *watchConfig, new *watchConfig) {
+			changes <- new
+		})
+		require.NoError(t, err)
+
+		client.Publish("app", "env", "profile", "workers: 3\n")
+
+		// the poll after the first signal gets the invalid config, the second signal comes after it
+		<-polls
+		<-polls
+		assert.Equal(t, "amqp://one", provider.Current().BrokerAddr)
+		assert.ErrorContains(t, provider.Status().ReloadErr, "broker-addr is required")
+		assert.Empty(t, changes)
+
+		client.Publish("app", "env", "profile", "broker-addr: amqp://three\nworkers: 3\n")
+		go func() {
+			for {
+				select {
+				case <-polls:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		select {
+		case cfg := <-changes:
+			assert.Equal(t, "amqp://three", cfg.BrokerAddr)
+			assert.NoError(t, provider.Status().ReloadErr)
+		case <-time.After(time.Second):
+			require.Fail(t, "config change was not notified")
+		}
+	})
+
+	t.Run("should start a new session after a failed poll", func(t *testing.T) {
+		client := newTestAppConfigData("broker-addr: amqp://one\n")
+		provider := newTestProvider(client)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		changes := make(chan *watchConfig, 1)
+		err := provider.Watch(ctx, func(old *watchConfig, new *watchConfig) {
+			changes <- new
+		})
+		require.NoError(t, err)
+
+		client.Throttle(1)
+		client.Publish("app", "env", "profile", "broker-addr: amqp://two\n")
+
+		select {
+		case cfg := <-changes:
+			assert.Equal(t, "amqp://two", cfg.BrokerAddr)
+		case <-time.After(time.Second):
+			require.Fail(t, "config change was not notified")
+		}
+
+		assert.Equal(t, 2, client.Sessions())
+	})
+
+	t.Run("should load the new config again after Parameter Store fails during a reload", func(t *testing.T) {
+		client := newTestAppConfigData("broker-addr: ${ssm:/app/broker}\n")
+		ssmClient := awstest.NewSsm()
+		ssmClient.PutSecureString("/app/broker", "amqp://one")
+
+		provider, err := NewProvider[*watchConfig]("us-west-2", "app", "profile", "env",
+			WithAppConfigDataClient(client),
+			WithSsmClient(ssmClient),
+			WithSecretsManagerClient(awstest.NewSecretsManager()),
+		)
+		require.NoError(t, err)
+		provider.after = newTestProvider(client).after
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		polls := signalPolls(ctx, provider)
+
+		changes := make(chan *watchConfig, 1)
+		err = provider.Watch(ctx, func(old *watchConfig, new *watchConfig) {
+			changes <- new
+		})
+		require.NoError(t, err)
+
+		ssmClient.PutSecureString("/app/broker", "amqp://two")
+		ssmClient.Throttle(1)
+		client.Publish("app", "env", "profile", "broker-addr: ${ssm:/app/broker}\nworkers: 2\n")
+
+		<-polls
+		<-polls
+		assert.Equal(t, "amqp://one", provider.Current().BrokerAddr)
+
+		<-polls
+		select {
+		case cfg := <-changes:
+			assert.Equal(t, watchConfig{BrokerAddr: "amqp://two", Workers: 2}, *cfg)
+		case <-time.After(time.Second):
+			require.Fail(t, "config change was not notified")
+		}
+
+		assert.Equal(t, 1, client.Sessions())
+	})
+
+	t.Run("should reload the config when a parameter changes without an AppConfig change", func(t *testing.T) {
+		client := newTestAppConfigData("broker-addr: ${ssm:/app/broker}\n")
+		ssmClient := awstest.NewSsm()
+		ssmClient.PutSecureString("/app/broker", "amqp://one")
+
+		provider, err := NewProvider[*watchConfig]("us-west-2", "app", "profile", "env",
+			WithAppConfigDataClient(client),
+			WithSsmClient(ssmClient),
+			WithSecretsManagerClient(awstest.NewSecretsManager()),
+		)
+		require.NoError(t, err)
+		provider.after = newTestProvider(client).after
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		changes := make(chan [2]*watchConfig, 1)
+		err = provider.Watch(ctx, func(old *watchConfig, new *watchConfig) {
+			changes <- [2]*watchConfig{old, new}
+		})
+		require.NoError(t, err)
+
+		ssmClient.PutSecureString("/app/broker", "amqp://rotated")
+
+		select {
+		case change := <-changes:
+			assert.Equal(t, "amqp://one", change[0].BrokerAddr)
+			assert.Equal(t, "amqp://rotated", change[1].BrokerAddr)
+		case <-time.After(time.Second):
+			require.Fail(t, "config change was not notified")
+		}
+	})
+
+	t.Run("should not notify when the reloaded config is unchanged", func(t *testing.T) {
+		client := newTestAppConfigData("broker-addr: amqp://one\n")
+		provider := newTestProvider(client)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		polls := signalPolls(ctx, provider)
+
+		changes := make(chan *watchConfig, 1)
+		err := provider.Watch(ctx, func(old *watchConfig, new *watchConfig) {
+			changes <- new
+		})
+		require.NoError(t, err)
+
+		client.Publish("app", "env", "profile", "# comment\nbroker-addr: amqp://one\n")
+
+		<-polls
+		<-polls
+		assert.Empty(t, changes)
+	})
+
+	t.Run("should not watch the config twice", func(t *testing.T) {
+		provider := newTestProvider(newTestAppConfigData("broker-addr: amqp://one\n"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		require.NoError(t, provider.Watch(ctx, nil))
+		assert.EqualError(t, provider.Watch(ctx, nil), "the config is already being watched")
+
+		cancel()
+
+		assert.Eventually(t, func() bool {
+			return provider.Watch(context.Background(), nil) == nil
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("should fail when the initial config is invalid", func(t *testing.T) {
+		provider := newTestProvider(newTestAppConfigData("workers: 1\n"))
+
+		err := provider.Watch(context.Background(), nil)
+
+		assert.ErrorContains(t, err, "broker-addr is required")
+		assert.ErrorContains(t, provider.Watch(context.Background(), nil), "broker-addr is required")
+	})
+}
+
+func TestGetConfig(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	newProvider := func(content string) *Provider[*watchConfig] {
+		provider := newTestProvider(newTestAppConfigData(content))
+		ssmClient := awstest.NewSsm()
+		ssmClient.PutParameter("/app/broker", "not json")
+		provider.ssmClient = ssmClient
+		provider.WithParamStoreTransform("/app/broker", func(from string) (string, error) {
+			return "", errors.New("unexpected format")
+		})
+		provider.WithParamStoreTransform("/app/missing", func(from string) (string, error) {
+			return from, nil
+		})
+
+		return provider
+	}
+
+	t.Run("should skip missing and untransformable parameters", func(t *testing.T) {
+		provider := newProvider("broker-addr: amqp://broker\nworkers: 1\n")
+
+		cfg := &watchConfig{}
+		err := provider.GetConfig(context.Background(), cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, watchConfig{BrokerAddr: "amqp://broker", Workers: 1}, *cfg)
+	})
+
+	t.Run("should join the parameter and validation errors when strict", func(t *testing.T) {
+		provider := newProvider("workers: 1\n")
+		provider.WithStrictParamStore()
+
+		cfg := &watchConfig{}
+		err := provider.GetConfig(context.Background(), cfg)
+
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "failed to transform parameter /app/broker: unexpected format")
+		assert.ErrorContains(t, err, "invalid parameter /app/missing could not be loaded")
+		assert.ErrorContains(t, err, "broker-addr is required")
+		assert.Equal(t, 1, cfg.Workers)
+	})
+
+	t.Run("should resolve ssm placeholders", func(t *testing.T) {
+		ssmClient := awstest.NewSsm()
+		ssmClient.PutSecureString("/iam/prod/kafka", `{"host": "amqp://kafka"}`)
+		provider := newTestProvider(newTestAppConfigData("broker-addr: ${ssm:/iam/prod/kafka#host}\n"))
+		provider.ssmClient = ssmClient
+		provider.WithResolver("ssm", NewSsmResolver(ssmClient))
+
+		cfg := &watchConfig{}
+		err := provider.GetConfig(context.Background(), cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, "amqp://kafka", cfg.BrokerAddr)
+	})
+	t.Run("should resolve secretsmanager placeholders in the version stage", func(t *testing.T) {
+		secretsManagerClient := awstest.NewSecretsManager()
+		secretsManagerClient.PutSecretValue("app/broker", "amqp://current")
+		secretsManagerClient.PutSecretValue("app/broker", "amqp://pending", StagePending)
+
+		provider, err := NewProvider[*watchConfig]("us-west-2", "app", "profile", "env",
+			WithAppConfigDataClient(newTestAppConfigData("broker-addr: ${secretsmanager:app/broker}\n")),
+			WithSsmClient(awstest.NewSsm()),
+			WithSecretsManagerClient(secretsManagerClient),
+		)
+		require.NoError(t, err)
+		provider.WithSecretsVersionStage(StagePending)
+
+		cfg := &watchConfig{}
+		err = provider.GetConfig(context.Background(), cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, "amqp://pending", cfg.BrokerAddr)
+	})
+
+	t.Run("should keep resolved values as strings through the transforms", func(t *testing.T) {
+		t.Setenv("BROKER_ADDR", "007700")
+
+		ssmClient := awstest.NewSsm()
+		ssmClient.PutParameter("/app/workers", "workers: 2")
+		provider := newTestProvider(newTestAppConfigData("broker-addr: ${env:BROKER_ADDR}\n"))
+		provider.ssmClient = ssmClient
+		provider.WithResolver("env", goutilsconfig.EnvResolver)
+		provider.WithParamStoreTransform("/app/workers", func(from string) (string, error) {
+			return from, nil
+		})
+
+		cfg := &watchConfig{}
+		err := provider.GetConfig(context.Background(), cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, watchConfig{BrokerAddr: "007700", Workers: 2}, *cfg)
+	})
+
+	t.Run("should not resolve env and file placeholders unless enabled", func(t *testing.T) {
+		t.Setenv("BROKER_ADDR", "amqp://local")
+
+		provider := newTestProvider(newTestAppConfigData("broker-addr: ${env:BROKER_ADDR}\nworkers: ${file:/etc/passwd}\n"))
+
+		err := provider.GetConfig(context.Background(), &watchConfig{})
+
+		assert.ErrorContains(t, err, `no resolver is registered for placeholder scheme "env"`)
+		assert.ErrorContains(t, err, `no resolver is registered for placeholder scheme "file"`)
+	})
+
+	t.Run("should override the previous layers with the zero values set in AppConfig", func(t *testing.T) {
+		defaults := goutilsconfig.ProviderFunc[*watchConfig](func(ctx context.Context, cfg *watchConfig) error {
+			cfg.BrokerAddr = "amqp://default"
+			cfg.Workers = 4
+			return nil
+		})
+
+		layered := goutilsconfig.Layered(
+			goutilsconfig.Named[*watchConfig]("defaults", defaults),
+			goutilsconfig.Named[*watchConfig]("appconfig", newTestProvider(newTestAppConfigData("workers: 0\n"))),
+		)
+
+		cfg := &watchConfig{}
+		err := layered.GetConfig(context.Background(), cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, watchConfig{BrokerAddr: "amqp://default", Workers: 0}, *cfg)
+		assert.Equal(t, map[string]string{"BrokerAddr": "defaults", "Workers": "appconfig"}, layered.Sources())
+	})
+}
@@ -0,0 +1,27 @@
+package aws
+
+import (
+	"context"
+
+	goutilsconfig "gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config"
+)
+
+// NewSsmResolver creates a resolver for ${ssm:/name} placeholders that gets the decrypted values of the
+// Parameter Store parameters. The parameters of a config are fetched in batches.
+func NewSsmResolver(client SsmClient) goutilsconfig.Resolver {
+	return goutilsconfig.ResolverFunc(func(ctx context.Context, refs []string) (map[string]string, error) {
+		params, _, err := getParameters(ctx, client, refs)
+		if err != nil {
+			return nil, err
+		}
+
+		values := map[string]string{}
+		for _, param := range params {
+			if param.Name != nil && param.Value != nil {
+				values[*param.Name] = *param.Value
+			}
+		}
+
+		return values, nil
+	})
+}
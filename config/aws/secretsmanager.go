@@ -0,0 +1,92 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+
+	goutilsconfig "gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config"
+)
+
+const (
+	// StageCurrent is the version stage of the current version of a secret.
+	StageCurrent = "AWSCURRENT"
+
+	// StagePending is the version stage of the new version of a secret while it is being rotated.
+	StagePending = "AWSPENDING"
+)
+
+type SecretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// NewSecretsManagerResolver creates a resolver that gets the values of the Secrets Manager secrets, given by name
+// or ARN, in the version stage, e.g. StageCurrent. Secrets stored as binary are resolved as strings. Secrets that
+// don't exist are not resolved.
+func NewSecretsManagerResolver(client SecretsManagerClient, stage string) goutilsconfig.Resolver {
+	return goutilsconfig.ResolverFunc(func(ctx context.Context, refs []string) (map[string]string, error) {
+		values := map[string]string{}
+
+		var errs []error
+
+		for _, ref := range refs {
+			input := &secretsmanager.GetSecretValueInput{SecretId: &ref}
+			if stage != "" {
+				input.VersionStage = &stage
+			}
+
+			output, err := client.GetSecretValue(ctx, input)
+			if err != nil {
+				var notFoundErr *types.ResourceNotFoundException
+				if !errors.As(err, &notFoundErr) {
+					errs = append(errs, fmt.Errorf("failed to get secret %s: %w", ref, err))
+				}
+
+				continue
+			}
+
+			switch {
+			case output.SecretString != nil:
+				values[ref] = *output.SecretString
+			case output.SecretBinary != nil:
+				values[ref] = string(output.SecretBinary)
+			}
+		}
+
+		return values, errors.Join(errs...)
+	})
+}
+
+// SecretsProvider is a config provider that binds Secrets Manager secrets onto the config fields tagged with
+// `secret:"name#jsonKey"`, where the optional #jsonKey selects a key of a secret stored as a JSON object.
+// It is meant to be layered on top of other providers with config.Layered; the Provider also binds the
+// secrets itself when it has a SecretsManagerClient.
+type SecretsProvider[T goutilsconfig.Config] struct {
+	client SecretsManagerClient
+	stage  string
+}
+
+var _ goutilsconfig.Provider[goutilsconfig.Config] = &SecretsProvider[goutilsconfig.Config]{}
+
+// NewSecretsProvider creates a config provider that binds the secrets from Secrets Manager in their
+// current version.
+func NewSecretsProvider[T goutilsconfig.Config](client SecretsManagerClient) *SecretsProvider[T] {
+	return &SecretsProvider[T]{
+		client: client,
+		stage:  StageCurrent,
+	}
+}
+
+// WithVersionStage sets the version stage of the secrets to bind, e.g. StagePending to test a rotated secret
+// before it becomes current. The default is StageCurrent.
+func (provider *SecretsProvider[T]) WithVersionStage(stage string) {
+	provider.stage = stage
+}
+
+// GetConfig binds the secrets onto cfg.
+func (provider *SecretsProvider[T]) GetConfig(ctx context.Context, cfg T) error {
+	return goutilsconfig.BindSecrets(ctx, cfg, NewSecretsManagerResolver(provider.client, provider.stage))
+}
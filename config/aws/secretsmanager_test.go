@@ -0,0 +1,85 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config/aws/awstest"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+type databaseConfig struct {
+	Host     string `yaml:"host"`
+	Username string `secret:"prod/db#username"`
+	Password string `secret:"prod/db#password"`
+	Port     int    `secret:"prod/db#port"`
+}
+
+type secretsConfig struct {
+	Database databaseConfig `yaml:"database"`
+	ApiKey   string         `secret:"prod/api-key"`
+	Token    string         `secret:"true"`
+}
+
+func (c *secretsConfig) Validate() error {
+	return nil
+}
+
+func (c *secretsConfig) Strings() []string {
+	return nil
+}
+
+func TestSecretsProvider(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	ctx := context.Background()
+
+	client := awstest.NewSecretsManager()
+	client.PutSecretValue("prod/db", `{"username": "svc", "password": "hunter2", "port": 5432}`)
+	client.PutSecretValue("prod/db", `{"username": "svc", "password": "rotated", "port": 5432}`, StagePending)
+	client.PutSecretValue("prod/api-key", "abc123")
+
+	t.Run("should bind JSON and plain text secrets onto tagged fields", func(t *testing.T) {
+		cfg := &secretsConfig{Database: databaseConfig{Host: "db.local"}}
+
+		err := NewSecretsProvider[*secretsConfig](client).GetConfig(ctx, cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, secretsConfig{
+			Database: databaseConfig{Host: "db.local", Username: "svc", Password: "hunter2", Port: 5432},
+			ApiKey:   "abc123",
+		}, *cfg)
+		assert.ElementsMatch(t, []string{"prod/db", "prod/api-key"}, client.GetSecretValueCalls())
+	})
+
+	t.Run("should bind the secrets in the version stage", func(t *testing.T) {
+		provider := NewSecretsProvider[*secretsConfig](client)
+		provider.WithVersionStage(StagePending)
+
+		cfg := &secretsConfig{}
+		err := provider.GetConfig(ctx, cfg)
+
+		assert.EqualError(t, err, "could not bind secret prod/api-key: not found")
+		assert.Equal(t, "rotated", cfg.Database.Password)
+	})
+
+	t.Run("should bind secrets when loading from AppConfig", func(t *testing.T) {
+		provider := &Provider[*secretsConfig]{
+			application:          "app",
+			configProfile:        "profile",
+			env:                  "env",
+			appConfigDataClient:  newTestAppConfigData("database:\n  host: db.local\n"),
+			secretsManagerClient: client,
+			secretsStage:         StageCurrent,
+		}
+
+		cfg := &secretsConfig{}
+		err := provider.GetConfig(ctx, cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, "db.local", cfg.Database.Host)
+		assert.Equal(t, "hunter2", cfg.Database.Password)
+	})
+}
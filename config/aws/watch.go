@@ -0,0 +1,190 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/appconfigdata"
+
+	goutilsconfig "gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config"
+	goutilslog "gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+// Watch loads the config like GetConfig and then keeps the AppConfig session open, polling it for changes
+// at the interval given by AppConfig until ctx is done. It returns once the initial config is loaded;
+// use Current to get the latest config. It returns an error if the provider is already watching the config.
+//
+// At each poll, the config is loaded again from the latest content, so that rotated Parameter Store and
+// Secrets Manager values are picked up even when the AppConfig content doesn't change. When the loaded config
+// differs from the current one, it is validated before it atomically replaces the current one and onChange is
+// invoked with the old and the new config. A poll or reload that fails is logged and reported by Status until
+// the next successful reload, and the current config is kept.
+//
+// If the initial config can't be loaded and there is a last-known-good cache set with WithLastKnownGood,
+// the cached config becomes the current config and AppConfig is polled until a valid config is loaded.
+//
+// Example:
+//
+//	err := provider.Watch(ctx, func(old *Config, new *Config) {
+//		log.Infow("Config changed", "config", new.Strings())
+//	})
+func (provider *Provider[T]) Watch(ctx context.Context, onChange func(old T, new T)) error {
+	if !provider.watching.CompareAndSwap(false, true) {
+		return errors.New("the config is already being watched")
+	}
+
+	output, err := provider.fetch(ctx)
+
+	var cfg T
+	if err == nil {
+		cfg, err = provider.load(ctx, output.Configuration)
+	}
+
+	if err != nil {
+		cfg = goutilsconfig.New[T]()
+		if err := provider.fallback(ctx, cfg, err); err != nil {
+			provider.watching.Store(false)
+			return err
+		}
+
+		provider.current.Store(&cfg)
+
+		go provider.poll(ctx, nil, 0, nil, onChange)
+
+		return nil
+	}
+
+	provider.remember(ctx, cfg)
+	provider.current.Store(&cfg)
+
+	goutilslog.FromContext(ctx).Infow("Watching the config for changes", "pollIntervalInSeconds", output.NextPollIntervalInSeconds)
+
+	go provider.poll(ctx, output.NextPollConfigurationToken, output.NextPollIntervalInSeconds, output.Configuration, onChange)
+
+	return nil
+}
+
+// Current returns the config most recently loaded by Watch, or the zero value of T if Watch wasn't called.
+func (provider *Provider[T]) Current() T {
+	if cfg := provider.current.Load(); cfg != nil {
+		return *cfg
+	}
+
+	var zero T
+
+	return zero
+}
+
+// load decodes the content into a new config and validates it.
+func (provider *Provider[T]) load(ctx context.Context, content []byte) (T, error) {
+	cfg := goutilsconfig.New[T]()
+
+	return cfg, provider.decodeAndValidate(ctx, content, cfg)
+}
+
+func (provider *Provider[T]) poll(ctx context.Context, token *string, interval int32, content []byte, onChange func(old T, new T)) {
+	defer provider.watching.Store(false)
+
+	log := goutilslog.FromContext(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-provider.wait(interval):
+		}
+
+		output, err := provider.latest(ctx, token)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+				return
+			}
+
+			log.Errorw("Failed to poll config from AppConfig", "error", err)
+			provider.reloadFailed(err)
+
+			// a failed poll invalidates the session, so the next poll starts a new one
+			token = nil
+
+			continue
+		}
+
+		token = output.NextPollConfigurationToken
+		if output.NextPollIntervalInSeconds > 0 {
+			interval = output.NextPollIntervalInSeconds
+		}
+
+		// AppConfig returns no content when the config hasn't changed since the last poll, but the parameters
+		// and secrets it refers to may have
+		if len(output.Configuration) > 0 {
+			content = output.Configuration
+		}
+
+		if content == nil {
+			continue
+		}
+
+		cfg, err := provider.load(ctx, content)
+		if err != nil {
+			log.Errorw("Failed to reload config, keeping the current config", "error", err)
+			provider.reloadFailed(err)
+
+			continue
+		}
+
+		current := provider.current.Load()
+		if reflect.DeepEqual(*current, cfg) {
+			if status := provider.Status(); status.Fallback || status.ReloadErr != nil {
+				provider.remember(ctx, cfg)
+			}
+
+			continue
+		}
+
+		provider.remember(ctx, cfg)
+		provider.current.Store(&cfg)
+
+		log.Infof("Config reloaded from AppConfig")
+
+		if onChange != nil {
+			onChange(*current, cfg)
+		}
+	}
+}
+
+// latest gets the latest config content of the session of the token, or from a new session if there is no token.
+func (provider *Provider[T]) latest(ctx context.Context, token *string) (*appconfigdata.GetLatestConfigurationOutput, error) {
+	if token == nil {
+		return provider.fetch(ctx)
+	}
+
+	return provider.appConfigDataClient.GetLatestConfiguration(ctx, &appconfigdata.GetLatestConfigurationInput{
+		ConfigurationToken: token,
+	})
+}
+
+// reloadFailed reports the error of a failed poll or reload with Status, keeping the rest of the status.
+func (provider *Provider[T]) reloadFailed(err error) {
+	status := provider.Status()
+	status.ReloadErr = err
+	provider.status.Store(&status)
+}
+
+func (provider *Provider[T]) wait(seconds int32) <-chan time.Time {
+	if seconds <= 0 {
+		seconds = provider.pollInterval
+	}
+
+	if seconds <= 0 {
+		seconds = defaultPollInterval
+	}
+
+	after := provider.after
+	if after == nil {
+		after = time.After
+	}
+
+	return after(time.Duration(seconds) * time.Second)
+}
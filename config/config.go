@@ -1,8 +1,23 @@
 package config
 
+import "reflect"
+
 type Config interface {
 	// Strings returns a []string representation of all the configs in the Config
 	// mainly used for structured logging
 	Strings() []string
 	Validate() error
 }
+
+// New returns a new zero value of T. When T is a pointer to a config struct, as it usually is,
+// it points to a newly allocated struct so that it can be passed to Provider.GetConfig.
+func New[T Config]() T {
+	var cfg T
+
+	typ := reflect.TypeOf(&cfg).Elem()
+	if typ.Kind() == reflect.Pointer {
+		return reflect.New(typ.Elem()).Interface().(T)
+	}
+
+	return cfg
+}
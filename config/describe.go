@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+const maskedValue = "*****"
+
+// Describe returns a log friendly representation of every field of the config, which can be used to implement
+// Config.Strings. Nested structs are described field by field, e.g. "Broker.Addr: amqp://localhost". The value
+// of a field tagged with `secret`, e.g. `secret:"true"`, is masked unless it is empty or the tag is "false".
+//
+// Example:
+//
+//	func (c *Config) Strings() []string {
+//		return config.Describe(c)
+//	}
+func Describe(cfg any) []string {
+	value := reflect.ValueOf(cfg)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return []string{}
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return []string{fmt.Sprintf("%v", value.Interface())}
+	}
+
+	return describe(value, "", []string{})
+}
+
+func describe(value reflect.Value, path string, lines []string) []string {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldPath := joinPath(path, field.Name)
+		fieldValue := value.Field(i)
+
+		if isSecret(field) {
+			lines = append(lines, fmt.Sprintf("%s: %s", fieldPath, mask(fieldValue)))
+			continue
+		}
+
+		if fieldValue.Kind() == reflect.Pointer && isNested(field.Type.Elem()) && !fieldValue.IsNil() {
+			fieldValue = fieldValue.Elem()
+		}
+
+		if isNested(fieldValue.Type()) {
+			lines = describe(fieldValue, fieldPath, lines)
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%s: %v", fieldPath, fieldValue.Interface()))
+	}
+
+	return lines
+}
+
+func isSecret(field reflect.StructField) bool {
+	tag, ok := field.Tag.Lookup("secret")
+
+	return ok && tag != "" && tag != "false"
+}
+
+func mask(value reflect.Value) string {
+	if value.IsZero() {
+		return ""
+	}
+
+	return maskedValue
+}
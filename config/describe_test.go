@@ -0,0 +1,53 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+type secretsConfig struct {
+	Addr     string `secret:"false"`
+	Password string `secret:"true"`
+	Token    string `secret:"true"`
+	ApiKey   string `secret:"keys#api"`
+	Timeout  time.Duration
+	Tls      *tlsConfig
+	internal string
+}
+
+type tlsConfig struct {
+	Cert string
+	Key  string `secret:"true"`
+}
+
+func TestDescribe(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	t.Run("should describe nested fields and mask secrets", func(t *testing.T) {
+		cfg := &secretsConfig{
+			Addr:     "amqp://localhost",
+			Password: "hunter2",
+			ApiKey:   "abc",
+			Timeout:  time.Second,
+			Tls:      &tlsConfig{Cert: "cert.pem", Key: "private"},
+			internal: "hidden",
+		}
+
+		assert.Equal(t, []string{
+			"Addr: amqp://localhost",
+			"Password: *****",
+			"Token: ",
+			"ApiKey: *****",
+			"Timeout: 1s",
+			"Tls.Cert: cert.pem",
+			"Tls.Key: *****",
+		}, Describe(cfg))
+	})
+
+	t.Run("should describe nil nested structs", func(t *testing.T) {
+		assert.Contains(t, Describe(&secretsConfig{}), "Tls: <nil>")
+	})
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// Env returns a Provider that loads the fields whose environment variables, given by the `env` tag, are set.
+// Fields without a set environment variable are left untouched, so that it can be layered on top of other
+// providers with Layered.
+func Env[T Config]() Provider[T] {
+	return &envProvider[T]{
+		include: func(field reflect.StructField, prefix string) bool {
+			return envIsSet(field, prefix)
+		},
+	}
+}
+
+// Defaults returns a Provider that loads the defaults given by the `env-default` tag of the fields whose
+// environment variables are not set.
+func Defaults[T Config]() Provider[T] {
+	return &envProvider[T]{
+		include: func(field reflect.StructField, prefix string) bool {
+			_, hasDefault := field.Tag.Lookup("env-default")
+			return hasDefault && !envIsSet(field, prefix)
+		},
+	}
+}
+
+// envProvider reads the environment with cleanenv and loads the fields selected by include.
+type envProvider[T Config] struct {
+	include func(field reflect.StructField, prefix string) bool
+}
+
+func (env *envProvider[T]) GetConfig(ctx context.Context, cfg T) error {
+	_, err := env.LoadSource(ctx, cfg)
+
+	return err
+}
+
+func (env *envProvider[T]) LoadSource(ctx context.Context, cfg T) ([]string, error) {
+	target, err := structValue(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	envCfg := New[T]()
+	if err := cleanenv.ReadEnv(envCfg); err != nil {
+		return nil, err
+	}
+
+	source, err := structValue(envCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	copyFields(target, source, "", "", env.include, &paths)
+
+	return paths, nil
+}
+
+// copyFields copies the fields selected by include from source into target and appends their paths to paths.
+func copyFields(target reflect.Value, source reflect.Value, prefix string, path string, include func(field reflect.StructField, prefix string) bool, paths *[]string) {
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldPath := joinPath(path, field.Name)
+
+		if _, hasEnv := field.Tag.Lookup("env"); !hasEnv && isNested(field.Type) {
+			copyFields(target.Field(i), source.Field(i), prefix+field.Tag.Get("env-prefix"), fieldPath, include, paths)
+			continue
+		}
+
+		if include(field, prefix) {
+			target.Field(i).Set(source.Field(i))
+			*paths = append(*paths, fieldPath)
+		}
+	}
+}
+
+// envIsSet reports whether one of the environment variables of the field is set.
+func envIsSet(field reflect.StructField, prefix string) bool {
+	names, ok := field.Tag.Lookup("env")
+	if !ok {
+		return false
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if _, ok := os.LookupEnv(prefix + name); ok {
+			return true
+		}
+	}
+
+	return false
+}
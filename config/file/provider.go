@@ -4,17 +4,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config"
 	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+	"gopkg.in/yaml.v3"
 )
 
+const defaultPollInterval = 5 * time.Second
+
 type Provider[T config.Config] struct {
-	path string
+	path         string
+	pollInterval time.Duration
+	resolvers    *config.Resolvers
+	current      atomic.Pointer[T]
+	after        func(d time.Duration) <-chan time.Time
 }
 
+var (
+	_ config.Watcher[config.Config]      = &Provider[config.Config]{}
+	_ config.SourceLoader[config.Config] = &Provider[config.Config]{}
+)
+
 func (provider *Provider[T]) String() string {
 	builder := strings.Builder{}
 
@@ -32,17 +48,93 @@ func NewProvider[T config.Config](path string) (*Provider[T], error) {
 	}
 
 	return &Provider[T]{
-		path: path,
+		path:         path,
+		pollInterval: defaultPollInterval,
+		resolvers:    config.NewResolvers(),
+		after:        time.After,
 	}, nil
 }
 
+// WithResolver registers a resolver for the placeholders of the scheme in YAML files, in addition to the
+// ${env:NAME} and ${file:/path} placeholders that are always resolved.
+func (provider *Provider[T]) WithResolver(scheme string, resolver config.Resolver) {
+	if provider.resolvers == nil {
+		provider.resolvers = config.NewResolvers()
+	}
+
+	provider.resolvers.Register(scheme, resolver)
+}
+
+// WithPollInterval sets the interval at which Watch checks the file for changes. The default is 5 seconds.
+func (provider *Provider[T]) WithPollInterval(interval time.Duration) {
+	provider.pollInterval = interval
+}
+
+// GetConfig reads the file, along with the environment variables, into cfg and validates it. The placeholders
+// in YAML files are resolved first.
 func (cfgFile *Provider[T]) GetConfig(ctx context.Context, cfg T) error {
 	logger := log.FromContext(ctx)
 
 	logger.Infof("Loading config from file %s", cfgFile.path)
-	if err := cleanenv.ReadConfig(cfgFile.path, cfg); err != nil {
+
+	if !cfgFile.isYAML() {
+		if err := cleanenv.ReadConfig(cfgFile.path, cfg); err != nil {
+			return err
+		}
+
+		return cfg.Validate()
+	}
+
+	if _, err := cfgFile.readYAML(ctx, cfg); err != nil {
 		return err
 	}
 
-	return nil
+	if err := cleanenv.ReadEnv(cfg); err != nil {
+		return err
+	}
+
+	return cfg.Validate()
+}
+
+// LoadSource loads only the values in the file, which must be YAML or JSON, without the environment
+// variables or defaults, so that it can be layered with config.Layered. It returns the paths of the fields
+// whose keys are in the file.
+func (cfgFile *Provider[T]) LoadSource(ctx context.Context, cfg T) ([]string, error) {
+	logger := log.FromContext(ctx)
+
+	logger.Infof("Loading config from file %s", cfgFile.path)
+
+	content, err := cfgFile.readYAML(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.YAMLPaths(cfg, content)
+}
+
+// readYAML reads the file and unmarshals it into cfg once its placeholders are resolved. It returns the
+// resolved content.
+func (cfgFile *Provider[T]) readYAML(ctx context.Context, cfg T) ([]byte, error) {
+	content, err := os.ReadFile(cfgFile.path)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := cfgFile.resolvers
+	if resolvers == nil {
+		resolvers = config.NewResolvers()
+	}
+
+	resolved, err := resolvers.Resolve(ctx, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve placeholders in %s: %w", cfgFile.path, err)
+	}
+
+	return resolved, yaml.Unmarshal(resolved, cfg)
+}
+
+func (cfgFile *Provider[T]) isYAML() bool {
+	ext := strings.ToLower(filepath.Ext(cfgFile.path))
+
+	return ext == ".yml" || ext == ".yaml"
 }
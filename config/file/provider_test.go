@@ -0,0 +1,152 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+type testConfig struct {
+	BrokerAddr string `yaml:"broker-addr"`
+	Workers    int    `yaml:"workers"`
+}
+
+func (c *testConfig) Validate() error {
+	if c.BrokerAddr == "" {
+		return errors.New("broker-addr is required")
+	}
+
+	return nil
+}
+
+func (c *testConfig) Strings() []string {
+	return []string{fmt.Sprintf("BrokerAddr: %s", c.BrokerAddr), fmt.Sprintf("Workers: %d", c.Workers)}
+}
+
+// writeConfig writes the file with a later modification time than the previous write, since file systems
+// with a coarse timestamp resolution could otherwise hide the change.
+func writeConfig(t *testing.T, path string, content string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// signalPolls makes the provider wait for the test to receive from the returned channel before each poll.
+func signalPolls(ctx context.Context, provider *Provider[*testConfig]) <-chan struct{} {
+	polls := make(chan struct{})
+
+	provider.after = func(d time.Duration) <-chan time.Time {
+		select {
+		case polls <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		return time.After(time.Millisecond)
+	}
+
+	return polls
+}
+
+func TestWatch(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	start := time.Now().Add(-time.Hour)
+
+	t.Run("should reload the file and notify with old and new values", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, path, "broker-addr: amqp://one\nworkers: 1\n", start)
+
+		provider, err := NewProvider[*testConfig](path)
+		require.NoError(t, err)
+		provider.WithPollInterval(time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		changes := make(chan [2]*testConfig, 1)
+		err = provider.Watch(ctx, func(old *testConfig, new *testConfig) {
+			changes <- [2]*testConfig{old, new}
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "amqp://one", provider.Current().BrokerAddr)
+
+		writeConfig(t, path, "broker-addr: amqp://two\nworkers: 2\n", start.Add(time.Second))
+
+		select {
+		case change := <-changes:
+			assert.Equal(t, "amqp://one", change[0].BrokerAddr)
+			assert.Equal(t, "amqp://two", change[1].BrokerAddr)
+			assert.Equal(t, 2, provider.Current().Workers)
+		case <-time.After(time.Second):
+			require.Fail(t, "config change was not notified")
+		}
+	})
+
+	t.Run("should keep the last good config when the file is invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, path, "broker-addr: amqp://one\n", start)
+
+		provider, err := NewProvider[*testConfig](path)
+		require.NoError(t, err)
+		provider.WithPollInterval(time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		polls := signalPolls(ctx, provider)
+
+		changes := make(chan *testConfig, 2)
+		err = provider.Watch(ctx, func(old *testConfig, new *testConfig) {
+			changes <- new
+		})
+		require.NoError(t, err)
+
+		writeConfig(t, path, "workers: 3\n", start.Add(time.Second))
+
+		// the poll after the first signal reads the invalid file, the second signal comes after it
+		<-polls
+		<-polls
+		assert.Equal(t, "amqp://one", provider.Current().BrokerAddr)
+		assert.Empty(t, changes)
+
+		writeConfig(t, path, "broker-addr: amqp://three\n", start.Add(2*time.Second))
+
+		<-polls
+		<-polls
+		require.Len(t, changes, 1)
+		assert.Equal(t, "amqp://three", (<-changes).BrokerAddr)
+	})
+
+	t.Run("should not notify when the file is touched without changes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, path, "broker-addr: amqp://one\n", start)
+
+		provider, err := NewProvider[*testConfig](path)
+		require.NoError(t, err)
+		provider.WithPollInterval(time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		polls := signalPolls(ctx, provider)
+
+		notified := make(chan struct{}, 1)
+		err = provider.Watch(ctx, func(old *testConfig, new *testConfig) {
+			notified <- struct{}{}
+		})
+		require.NoError(t, err)
+
+		writeConfig(t, path, "broker-addr: amqp://one\n", start.Add(time.Second))
+
+		<-polls
+		<-polls
+		assert.Empty(t, notified, "unchanged config was notified")
+	})
+}
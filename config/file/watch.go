@@ -0,0 +1,140 @@
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/config"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/log"
+)
+
+// fileState identifies a version of the file. The modification time and size are checked on every poll,
+// the content hash only when they change so that touching the file doesn't trigger a reload.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// Watch loads the config like GetConfig and then polls the file for changes until ctx is done. It returns once
+// the initial config is loaded; use Current to get the latest config. Since the file is polled with os.Stat,
+// this also works for config mounted into a container, e.g. from a Kubernetes ConfigMap.
+//
+// When the content changes, the new config is validated before it atomically replaces the current one and
+// onChange is invoked with the old and the new config. If the new file can't be loaded or is invalid, the
+// error is logged and the last good config is kept.
+func (provider *Provider[T]) Watch(ctx context.Context, onChange func(old T, new T)) error {
+	state, err := provider.stat()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := provider.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	provider.current.Store(&cfg)
+
+	go provider.poll(ctx, state, onChange)
+
+	return nil
+}
+
+// Current returns the config most recently loaded by Watch, or the zero value of T if Watch wasn't called.
+func (provider *Provider[T]) Current() T {
+	if cfg := provider.current.Load(); cfg != nil {
+		return *cfg
+	}
+
+	var zero T
+
+	return zero
+}
+
+// load reads the file into a new, validated config.
+func (provider *Provider[T]) load(ctx context.Context) (T, error) {
+	cfg := config.New[T]()
+
+	return cfg, provider.GetConfig(ctx, cfg)
+}
+
+func (provider *Provider[T]) poll(ctx context.Context, state fileState, onChange func(old T, new T)) {
+	logger := log.FromContext(ctx)
+
+	interval := provider.pollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	after := provider.after
+	if after == nil {
+		after = time.After
+	}
+
+	loadedHash := state.hash
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-after(interval):
+		}
+
+		info, err := os.Stat(provider.path)
+		if err != nil {
+			logger.Errorw("Failed to check config file for changes, keeping the current config", "path", provider.path, "error", err)
+			continue
+		}
+
+		if info.ModTime().Equal(state.modTime) && info.Size() == state.size {
+			continue
+		}
+
+		newState, err := provider.stat()
+		if err != nil {
+			logger.Errorw("Failed to read config file, keeping the current config", "path", provider.path, "error", err)
+			continue
+		}
+
+		state = newState
+		if state.hash == loadedHash {
+			continue
+		}
+
+		cfg, err := provider.load(ctx)
+		if err != nil {
+			logger.Errorw("Failed to reload config file, keeping the current config", "path", provider.path, "error", err)
+			continue
+		}
+
+		loadedHash = state.hash
+		old := provider.current.Swap(&cfg)
+
+		logger.Infof("Config reloaded from file %s", provider.path)
+
+		if onChange != nil {
+			onChange(*old, cfg)
+		}
+	}
+}
+
+func (provider *Provider[T]) stat() (fileState, error) {
+	info, err := os.Stat(provider.path)
+	if err != nil {
+		return fileState{}, err
+	}
+
+	content, err := os.ReadFile(provider.path)
+	if err != nil {
+		return fileState{}, err
+	}
+
+	return fileState{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		hash:    sha256.Sum256(content),
+	}, nil
+}
@@ -0,0 +1,333 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SourceLoader can be implemented by a Provider to load only the values present in its own source, without
+// environment variables or defaults, so that it doesn't override the values of previous layers with them
+// when used in a LayeredProvider. LoadSource returns the paths of the fields it set, e.g. "Broker.Password",
+// which override the values of previous layers even when they are set to the zero value.
+type SourceLoader[T Config] interface {
+	LoadSource(ctx context.Context, cfg T) ([]string, error)
+}
+
+// ProviderFunc adapts a function to a Provider, e.g. to set defaults or apply command line flags.
+type ProviderFunc[T Config] func(ctx context.Context, cfg T) error
+
+func (fn ProviderFunc[T]) GetConfig(ctx context.Context, cfg T) error {
+	return fn(ctx, cfg)
+}
+
+type namedProvider[T Config] struct {
+	name     string
+	provider Provider[T]
+}
+
+// Named names the provider so that the values it supplies can be traced back to it with
+// LayeredProvider.Sources.
+func Named[T Config](name string, provider Provider[T]) Provider[T] {
+	return &namedProvider[T]{name: name, provider: provider}
+}
+
+func (named *namedProvider[T]) GetConfig(ctx context.Context, cfg T) error {
+	return named.provider.GetConfig(ctx, cfg)
+}
+
+func (named *namedProvider[T]) LoadSource(ctx context.Context, cfg T) ([]string, error) {
+	return loadLayer(ctx, named.provider, cfg)
+}
+
+func (named *namedProvider[T]) String() string {
+	return named.name
+}
+
+// LayeredProvider combines several providers into one. See Layered.
+type LayeredProvider[T Config] struct {
+	layers  []Provider[T]
+	mutex   sync.Mutex
+	sources map[string]string
+}
+
+var _ Provider[Config] = &LayeredProvider[Config]{}
+
+// Layered combines the providers into a single Provider in order of increasing precedence: each layer is
+// loaded into a new config and every field it sets overrides the value of the previous layers. Providers
+// that implement SourceLoader, such as Env and the file and AWS providers, are loaded with LoadSource and
+// set the fields it reports, even to the zero value, e.g. DEBUG=false. Other providers are considered to
+// set the fields that are not the zero value, so they can't reset a field to its zero value.
+//
+// Example:
+//
+//	provider := config.Layered(
+//		config.Named("defaults", config.Defaults[*Config]()),
+//		config.Named[*Config]("file", fileProvider),
+//		config.Named[*Config]("appconfig", awsProvider),
+//		config.Named("env", config.Env[*Config]()),
+//	)
+func Layered[T Config](layers ...Provider[T]) *LayeredProvider[T] {
+	return &LayeredProvider[T]{
+		layers:  layers,
+		sources: map[string]string{},
+	}
+}
+
+// GetConfig loads every layer in order, merges them into cfg, which must be a non-nil pointer to a config
+// struct, and validates the result. The errors of the layers that failed and the validation errors are
+// joined into one.
+func (layered *LayeredProvider[T]) GetConfig(ctx context.Context, cfg T) error {
+	target, err := structValue(cfg)
+	if err != nil {
+		return err
+	}
+
+	sources := map[string]string{}
+
+	var errs []error
+
+	for i, layer := range layered.layers {
+		name := layerName(i, layer)
+
+		layerCfg := New[T]()
+		paths, err := loadLayer(ctx, layer, layerCfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load config layer %s: %w", name, err))
+			continue
+		}
+
+		source, err := structValue(layerCfg)
+		if err != nil {
+			return err
+		}
+
+		set := make(map[string]bool, len(paths))
+		for _, path := range paths {
+			set[path] = true
+		}
+
+		overlay(target, source, "", set, name, sources)
+	}
+
+	layered.mutex.Lock()
+	layered.sources = sources
+	layered.mutex.Unlock()
+
+	return errors.Join(append(errs, cfg.Validate())...)
+}
+
+// Sources returns the name of the layer that supplied each field set by the last call to GetConfig, keyed
+// by the field path, e.g. "Broker.Password". Layers that weren't given a name with Named are named
+// after their type.
+func (layered *LayeredProvider[T]) Sources() map[string]string {
+	layered.mutex.Lock()
+	defer layered.mutex.Unlock()
+
+	sources := make(map[string]string, len(layered.sources))
+	for path, name := range layered.sources {
+		sources[path] = name
+	}
+
+	return sources
+}
+
+// loadLayer loads the provider into cfg and returns the paths of the fields it set. The fields set by a
+// provider that doesn't implement SourceLoader are the ones that are not the zero value.
+func loadLayer[T Config](ctx context.Context, provider Provider[T], cfg T) ([]string, error) {
+	if loader, ok := provider.(SourceLoader[T]); ok {
+		return loader.LoadSource(ctx, cfg)
+	}
+
+	if err := provider.GetConfig(ctx, cfg); err != nil {
+		return nil, err
+	}
+
+	value, err := structValue(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	nonZeroPaths(value, "", &paths)
+
+	return paths, nil
+}
+
+func layerName[T Config](index int, provider Provider[T]) string {
+	if named, ok := provider.(*namedProvider[T]); ok {
+		return named.name
+	}
+
+	return fmt.Sprintf("%d:%T", index, provider)
+}
+
+// structValue returns the struct that cfg points to.
+func structValue(cfg any) (reflect.Value, error) {
+	value := reflect.ValueOf(cfg)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("config must be a non-nil pointer to a struct, got %T", cfg)
+	}
+
+	return value.Elem(), nil
+}
+
+// overlay sets every field of target whose path is in set to the value of the same field in source, and records
+// the layer that supplied it in sources. Nested structs are merged field by field.
+func overlay(target reflect.Value, source reflect.Value, path string, set map[string]bool, layer string, sources map[string]string) {
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldPath := joinPath(path, field.Name)
+
+		if set[fieldPath] {
+			target.Field(i).Set(source.Field(i))
+			sources[fieldPath] = layer
+			continue
+		}
+
+		if isNested(field.Type) {
+			overlay(target.Field(i), source.Field(i), fieldPath, set, layer, sources)
+		}
+	}
+}
+
+// nonZeroPaths appends the paths of the fields of value that are not the zero value to paths.
+func nonZeroPaths(value reflect.Value, path string, paths *[]string) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldPath := joinPath(path, field.Name)
+
+		if isNested(field.Type) {
+			nonZeroPaths(value.Field(i), fieldPath, paths)
+			continue
+		}
+
+		if !value.Field(i).IsZero() {
+			*paths = append(*paths, fieldPath)
+		}
+	}
+}
+
+// YAMLPaths returns the paths of the fields of cfg, which must be a pointer to a struct, that are set by the YAML
+// content, e.g. "Broker.Password" for the password key of the broker key. Keys are matched with the names in
+// the `yaml` tags or, without a tag, the lowercased field names. It helps implement SourceLoader.
+func YAMLPaths(cfg any, content []byte) ([]string, error) {
+	value, err := structValue(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if len(document.Content) > 0 {
+		yamlPaths(value.Type(), document.Content[0], "", &paths)
+	}
+
+	return paths, nil
+}
+
+func yamlPaths(typ reflect.Type, node *yaml.Node, path string, paths *[]string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		if key.Tag == "!!merge" {
+			yamlPaths(typ, value, path, paths)
+			continue
+		}
+
+		fieldPath, fieldType, ok := yamlField(typ, key.Value, path)
+		if !ok {
+			continue
+		}
+
+		if isNested(fieldType) && value.Kind != yaml.ScalarNode {
+			yamlPaths(fieldType, value, fieldPath, paths)
+			continue
+		}
+
+		*paths = append(*paths, fieldPath)
+	}
+}
+
+// yamlField finds the field of the struct type that the YAML key is unmarshalled into, including the fields of
+// inlined structs, and returns its path and type.
+func yamlField(typ reflect.Type, key string, path string) (string, reflect.Type, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if strings.Contains(options, "inline") && field.Type.Kind() == reflect.Struct {
+			if fieldPath, fieldType, ok := yamlField(field.Type, key, joinPath(path, field.Name)); ok {
+				return fieldPath, fieldType, true
+			}
+
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		if name == key {
+			return joinPath(path, field.Name), field.Type, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// isNested reports whether the type is a struct with exported fields, which is merged field by field,
+// rather than a value like time.Time.
+func isNested(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).IsExported() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+)
+
+type brokerConfig struct {
+	Addr     string `yaml:"addr" env:"ADDR" env-default:"amqp://localhost:5672"`
+	Password string `yaml:"password" env:"PASSWORD"`
+}
+
+type testConfig struct {
+	Broker  brokerConfig `yaml:"broker" env-prefix:"BROKER_"`
+	Workers int          `yaml:"workers" env:"WORKERS" env-default:"1"`
+	Debug   bool         `yaml:"debug" env:"DEBUG"`
+}
+
+func (c *testConfig) Validate() error {
+	return nil
+}
+
+func (c *testConfig) Strings() []string {
+	return nil
+}
+
+func TestLayered(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	ctx := context.Background()
+
+	file := ProviderFunc[*testConfig](func(ctx context.Context, cfg *testConfig) error {
+		cfg.Broker.Addr = "amqp://file:5672"
+		cfg.Broker.Password = "from-file"
+		cfg.Workers = 4
+		return nil
+	})
+
+	remote := ProviderFunc[*testConfig](func(ctx context.Context, cfg *testConfig) error {
+		cfg.Broker.Password = "from-appconfig"
+		return nil
+	})
+
+	t.Run("should let later layers override earlier ones and record the sources", func(t *testing.T) {
+		t.Setenv("BROKER_ADDR", "amqp://env:5672")
+
+		layered := Layered(
+			Named("defaults", Defaults[*testConfig]()),
+			Named[*testConfig]("file", file),
+			Named[*testConfig]("appconfig", remote),
+			Named("env", Env[*testConfig]()),
+		)
+
+		cfg := &testConfig{}
+		require.NoError(t, layered.GetConfig(ctx, cfg))
+
+		assert.Equal(t, testConfig{
+			Broker:  brokerConfig{Addr: "amqp://env:5672", Password: "from-appconfig"},
+			Workers: 4,
+		}, *cfg)
+		assert.Equal(t, map[string]string{
+			"Broker.Addr":     "env",
+			"Broker.Password": "appconfig",
+			"Workers":         "file",
+		}, layered.Sources())
+	})
+
+	t.Run("should only apply defaults of unset environment variables", func(t *testing.T) {
+		t.Setenv("WORKERS", "8")
+		t.Setenv("DEBUG", "true")
+
+		cfg := &testConfig{}
+		require.NoError(t, Layered(Defaults[*testConfig](), Env[*testConfig]()).GetConfig(ctx, cfg))
+
+		assert.Equal(t, "amqp://localhost:5672", cfg.Broker.Addr)
+		assert.Equal(t, 8, cfg.Workers)
+		assert.True(t, cfg.Debug)
+	})
+
+	t.Run("should let environment variables set zero values", func(t *testing.T) {
+		t.Setenv("WORKERS", "0")
+		t.Setenv("DEBUG", "false")
+
+		debug := ProviderFunc[*testConfig](func(ctx context.Context, cfg *testConfig) error {
+			cfg.Debug = true
+			return nil
+		})
+
+		layered := Layered(
+			Named[*testConfig]("file", file),
+			Named[*testConfig]("debug", debug),
+			Named("env", Env[*testConfig]()),
+		)
+
+		cfg := &testConfig{}
+		require.NoError(t, layered.GetConfig(ctx, cfg))
+
+		assert.Equal(t, 0, cfg.Workers)
+		assert.False(t, cfg.Debug)
+		assert.Equal(t, "env", layered.Sources()["Workers"])
+		assert.Equal(t, "env", layered.Sources()["Debug"])
+	})
+
+	t.Run("should fail with the name of the layer that failed", func(t *testing.T) {
+		failing := ProviderFunc[*testConfig](func(ctx context.Context, cfg *testConfig) error {
+			return errors.New("unavailable")
+		})
+
+		err := Layered(Named[*testConfig]("appconfig", failing)).GetConfig(ctx, &testConfig{})
+
+		assert.EqualError(t, err, "failed to load config layer appconfig: unavailable")
+	})
+}
+
+type yamlPathsConfig struct {
+	Broker  brokerConfig `yaml:",inline"`
+	Debug   bool         `yaml:"debug"`
+	Name    string
+	Ignored string         `yaml:"-"`
+	Labels  map[string]any `yaml:"labels"`
+}
+
+func TestYAMLPaths(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	t.Run("should return the paths of the fields set by the content", func(t *testing.T) {
+		content := "password: \"\"\ndebug: false\nname: app\nlabels:\n  team: id\nignored: x\nunknown: 1\n"
+
+		paths, err := YAMLPaths(&yamlPathsConfig{}, []byte(content))
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"Broker.Password",
+			"Debug",
+			"Name",
+			"Labels",
+		}, paths)
+	})
+
+	t.Run("should return the paths of nested fields", func(t *testing.T) {
+		paths, err := YAMLPaths(&testConfig{}, []byte("broker:\n  addr: \"\"\nworkers: 0\n"))
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Broker.Addr", "Workers"}, paths)
+	})
+
+	t.Run("should return no paths for empty content", func(t *testing.T) {
+		paths, err := YAMLPaths(&testConfig{}, nil)
+
+		require.NoError(t, err)
+		assert.Empty(t, paths)
+	})
+}
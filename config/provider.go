@@ -6,3 +6,16 @@ type Provider[T Config] interface {
 	// The input parameter, cfg T, must be a non-nil pointer to a config struct.
 	GetConfig(ctx context.Context, cfg T) error
 }
+
+// Watcher is a Provider that can reload the config when its source changes.
+type Watcher[T Config] interface {
+	Provider[T]
+
+	// Watch loads the config and then reloads it whenever its source changes until ctx is done. A reloaded
+	// config is validated before it replaces the current one and onChange is invoked with the old and
+	// the new config.
+	Watch(ctx context.Context, onChange func(old T, new T)) error
+
+	// Current returns the config most recently loaded by Watch.
+	Current() T
+}
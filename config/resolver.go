@@ -0,0 +1,297 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// placeholderPattern matches placeholders like ${env:DB_HOST} or ${ssm:/iam/prod/kafka#password}.
+var placeholderPattern = regexp.MustCompile(`\$\{([A-Za-z][A-Za-z0-9_-]*):([^}]+)\}`)
+
+// Resolver resolves the references of the placeholders of a scheme, e.g. "DB_HOST" for ${env:DB_HOST}.
+type Resolver interface {
+	// Resolve returns the value of every reference it could resolve. All the references of the scheme in
+	// a config are resolved with a single call so that lookups can be batched.
+	Resolve(ctx context.Context, refs []string) (map[string]string, error)
+}
+
+// ResolverFunc adapts a function to a Resolver.
+type ResolverFunc func(ctx context.Context, refs []string) (map[string]string, error)
+
+func (fn ResolverFunc) Resolve(ctx context.Context, refs []string) (map[string]string, error) {
+	return fn(ctx, refs)
+}
+
+var (
+	// EnvResolver resolves environment variables, e.g. ${env:DB_HOST}.
+	EnvResolver Resolver = ResolverFunc(resolveEnv)
+
+	// FileResolver resolves the content of files without the trailing line break, e.g. ${file:/run/secrets/pw}.
+	FileResolver Resolver = ResolverFunc(resolveFile)
+)
+
+// Resolvers is a registry of Resolver per placeholder scheme that replaces the placeholders in YAML config
+// content with their values. A reference can select a key of a JSON object value with a # suffix, e.g.
+// ${file:/run/secrets/db#password}; the resolver is given the reference without it. The zero value is an
+// empty registry.
+type Resolvers struct {
+	resolvers map[string]Resolver
+}
+
+// NewResolvers creates a registry with the "env" scheme, resolved by EnvResolver, and the "file" scheme,
+// resolved by FileResolver.
+func NewResolvers() *Resolvers {
+	resolvers := &Resolvers{}
+	resolvers.Register("env", EnvResolver)
+	resolvers.Register("file", FileResolver)
+
+	return resolvers
+}
+
+// Register registers the resolver for the scheme, replacing any previous one.
+func (resolvers *Resolvers) Register(scheme string, resolver Resolver) {
+	if resolvers.resolvers == nil {
+		resolvers.resolvers = map[string]Resolver{}
+	}
+
+	resolvers.resolvers[scheme] = resolver
+}
+
+// Resolve replaces the placeholders in the values of the YAML content. An unquoted value that is exactly one
+// placeholder is typed like a parameter loaded from a Parameter Store path, so that e.g. ${env:DB_PORT} can be
+// loaded into an int field, as long as the resolved value reads back the same, so that e.g. a secret like 007700
+// or null is kept as a string. Every other resolved value is a string. Schemes without a resolver and
+// resolver failures are reported in the returned error or, if there are none, every placeholder that can't be
+// resolved.
+func (resolvers *Resolvers) Resolve(ctx context.Context, content []byte) ([]byte, error) {
+	if !bytes.Contains(content, []byte("${")) {
+		return content, nil
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	scalars := collectScalars(&document, nil)
+
+	refs := map[string]map[string]bool{}
+	for _, scalar := range scalars {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(scalar.Value, -1) {
+			scheme, ref := match[1], baseRef(match[2])
+			if refs[scheme] == nil {
+				refs[scheme] = map[string]bool{}
+			}
+
+			refs[scheme][ref] = true
+		}
+	}
+
+	if len(refs) == 0 {
+		return content, nil
+	}
+
+	values, err := resolvers.resolveAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+
+	for _, scalar := range scalars {
+		if !placeholderPattern.MatchString(scalar.Value) {
+			continue
+		}
+
+		single := scalar.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) == 0 &&
+			placeholderPattern.FindString(scalar.Value) == scalar.Value
+
+		scalar.Value = placeholderPattern.ReplaceAllStringFunc(scalar.Value, func(placeholder string) string {
+			match := placeholderPattern.FindStringSubmatch(placeholder)
+
+			value, err := lookup(values[match[1]], match[2])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not resolve %s: %w", placeholder, err))
+			}
+
+			return value
+		})
+
+		scalar.Tag = "!!str"
+		if single {
+			scalar.Tag = typedTag(scalar.Value)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return yaml.Marshal(&document)
+}
+
+// typedTag returns the tag of the bool or number that the value reads as, if it reads back the same when encoded,
+// and !!str otherwise.
+func typedTag(value string) string {
+	var decoded any
+	if err := (&yaml.Node{Kind: yaml.ScalarNode, Value: value}).Decode(&decoded); err != nil {
+		return "!!str"
+	}
+
+	var tag string
+
+	switch decoded.(type) {
+	case bool:
+		tag = "!!bool"
+	case int, uint64:
+		tag = "!!int"
+	case float64:
+		tag = "!!float"
+	default:
+		return "!!str"
+	}
+
+	encoded, err := yaml.Marshal(decoded)
+	if err != nil || strings.TrimSpace(string(encoded)) != value {
+		return "!!str"
+	}
+
+	return tag
+}
+
+// resolveAll resolves the references with the resolver of their scheme, one call per scheme.
+func (resolvers *Resolvers) resolveAll(ctx context.Context, refs map[string]map[string]bool) (map[string]map[string]string, error) {
+	schemes := make([]string, 0, len(refs))
+	for scheme := range refs {
+		schemes = append(schemes, scheme)
+	}
+
+	sort.Strings(schemes)
+
+	values := map[string]map[string]string{}
+
+	var errs []error
+
+	for _, scheme := range schemes {
+		resolver, ok := resolvers.resolvers[scheme]
+		if !ok {
+			errs = append(errs, fmt.Errorf("no resolver is registered for placeholder scheme %q", scheme))
+			continue
+		}
+
+		schemeRefs := make([]string, 0, len(refs[scheme]))
+		for ref := range refs[scheme] {
+			schemeRefs = append(schemeRefs, ref)
+		}
+
+		sort.Strings(schemeRefs)
+
+		resolved, err := resolver.Resolve(ctx, schemeRefs)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to resolve %s placeholders: %w", scheme, err))
+			continue
+		}
+
+		values[scheme] = resolved
+	}
+
+	return values, errors.Join(errs...)
+}
+
+// collectScalars returns the scalar values, not the keys, of the node and its children.
+func collectScalars(node *yaml.Node, scalars []*yaml.Node) []*yaml.Node {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return append(scalars, node)
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			scalars = collectScalars(node.Content[i], scalars)
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			scalars = collectScalars(child, scalars)
+		}
+	}
+
+	return scalars
+}
+
+func baseRef(ref string) string {
+	base, _, _ := strings.Cut(ref, "#")
+
+	return base
+}
+
+// lookup returns the value of the reference, or of the key of its JSON object value after a #.
+func lookup(values map[string]string, ref string) (string, error) {
+	base, key, hasKey := strings.Cut(ref, "#")
+
+	value, ok := values[base]
+	if !ok {
+		return "", errors.New("not found")
+	}
+
+	if !hasKey {
+		return value, nil
+	}
+
+	object := map[string]any{}
+	if err := json.Unmarshal([]byte(value), &object); err != nil {
+		return "", fmt.Errorf("value is not a JSON object: %w", err)
+	}
+
+	keyValue, ok := object[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found", key)
+	}
+
+	if str, ok := keyValue.(string); ok {
+		return str, nil
+	}
+
+	encoded, err := json.Marshal(keyValue)
+
+	return string(encoded), err
+}
+
+func resolveEnv(ctx context.Context, refs []string) (map[string]string, error) {
+	values := map[string]string{}
+
+	for _, ref := range refs {
+		if value, ok := os.LookupEnv(ref); ok {
+			values[ref] = value
+		}
+	}
+
+	return values, nil
+}
+
+func resolveFile(ctx context.Context, refs []string) (map[string]string, error) {
+	values := map[string]string{}
+
+	var errs []error
+
+	for _, ref := range refs {
+		content, err := os.ReadFile(ref)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+
+			continue
+		}
+
+		values[ref] = strings.TrimRight(string(content), "\r\n")
+	}
+
+	return values, errors.Join(errs...)
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.edgecastcdn.net/edgecast/web-platform/identity/goutils/testcat"
+	"gopkg.in/yaml.v3"
+)
+
+type placeholderConfig struct {
+	Host     string `yaml:"host"`
+	Url      string `yaml:"url"`
+	Port     string `yaml:"port"`
+	Password string `yaml:"password"`
+	Username string `yaml:"username"`
+}
+
+func TestResolvers(t *testing.T) {
+	testcat.CheckTestCategory(t, testcat.UnitTest)
+
+	ctx := context.Background()
+
+	secretPath := filepath.Join(t.TempDir(), "db")
+	require.NoError(t, os.WriteFile(secretPath, []byte(`{"username": "svc", "password": "hunter2"}`+"\n"), 0o600))
+
+	t.Run("should resolve env and file placeholders", func(t *testing.T) {
+		t.Setenv("DB_HOST", "db.local")
+		t.Setenv("DB_PORT", "5432")
+
+		content := `
+host: ${env:DB_HOST}
+url: postgres://${env:DB_HOST}:${env:DB_PORT}/app
+port: "${env:DB_PORT}"
+password: ${file:` + secretPath + `#password}
+username: ${file:` + secretPath + `#username}
+`
+
+		resolved, err := NewResolvers().Resolve(ctx, []byte(content))
+		require.NoError(t, err)
+
+		cfg := placeholderConfig{}
+		require.NoError(t, yaml.Unmarshal(resolved, &cfg))
+		assert.Equal(t, placeholderConfig{
+			Host:     "db.local",
+			Url:      "postgres://db.local:5432/app",
+			Port:     "5432",
+			Password: "hunter2",
+			Username: "svc",
+		}, cfg)
+	})
+
+	t.Run("should resolve all the references of a scheme with one call", func(t *testing.T) {
+		calls := [][]string{}
+		resolvers := NewResolvers()
+		resolvers.Register("vault", ResolverFunc(func(ctx context.Context, refs []string) (map[string]string, error) {
+			calls = append(calls, refs)
+			return map[string]string{"db": `{"password": "hunter2"}`, "host": "db.local"}, nil
+		}))
+
+		resolved, err := resolvers.Resolve(ctx, []byte("host: ${vault:host}\npassword: ${vault:db#password}\nusername: ${vault:db#username}\n"))
+
+		assert.Nil(t, resolved)
+		assert.EqualError(t, err, "could not resolve ${vault:db#username}: key username not found")
+		assert.Equal(t, [][]string{{"db", "host"}}, calls)
+	})
+
+	t.Run("should report every unresolvable placeholder", func(t *testing.T) {
+		_, err := NewResolvers().Resolve(ctx, []byte("host: ${env:UNSET_DB_HOST}\npassword: ${vault:db}\n"))
+
+		assert.EqualError(t, err, `no resolver is registered for placeholder scheme "vault"`)
+
+		_, err = NewResolvers().Resolve(ctx, []byte("host: ${env:UNSET_DB_HOST}\npassword: ${file:/does/not/exist}\n"))
+
+		assert.ErrorContains(t, err, "could not resolve ${env:UNSET_DB_HOST}: not found")
+		assert.ErrorContains(t, err, "could not resolve ${file:/does/not/exist}: not found")
+	})
+
+	t.Run("should keep the resolved values that don't read back the same as strings", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD", "007700")
+		t.Setenv("DB_USERNAME", "~")
+		t.Setenv("DB_HOST", "null")
+		t.Setenv("DB_PORT", "5432")
+
+		resolved, err := NewResolvers().Resolve(ctx, []byte("password: ${env:DB_PASSWORD}\nusername: ${env:DB_USERNAME}\nhost: ${env:DB_HOST}\nport: ${env:DB_PORT}\n"))
+		require.NoError(t, err)
+
+		values := map[string]any{}
+		require.NoError(t, yaml.Unmarshal(resolved, values))
+		assert.Equal(t, map[string]any{"password": "007700", "username": "~", "host": "null", "port": 5432}, values)
+	})
+
+	t.Run("should resolve placeholders into int and bool fields", func(t *testing.T) {
+		t.Setenv("DB_PORT", "5432")
+		t.Setenv("DB_TLS", "true")
+		t.Setenv("DB_TIMEOUT", "1.5")
+
+		resolved, err := NewResolvers().Resolve(ctx, []byte("port: ${env:DB_PORT}\ntls: ${env:DB_TLS}\ntimeout: ${env:DB_TIMEOUT}\nname: \"${env:DB_PORT}\"\n"))
+		require.NoError(t, err)
+
+		cfg := struct {
+			Port    int     `yaml:"port"`
+			Tls     bool    `yaml:"tls"`
+			Timeout float64 `yaml:"timeout"`
+			Name    string  `yaml:"name"`
+		}{}
+		require.NoError(t, yaml.Unmarshal(resolved, &cfg))
+		assert.Equal(t, 5432, cfg.Port)
+		assert.True(t, cfg.Tls)
+		assert.Equal(t, 1.5, cfg.Timeout)
+		assert.Equal(t, "5432", cfg.Name)
+	})
+
+	t.Run("should leave content without placeholders untouched", func(t *testing.T) {
+		content := []byte("# comment\nhost: localhost\n")
+
+		resolved, err := NewResolvers().Resolve(ctx, content)
+
+		require.NoError(t, err)
+		assert.Equal(t, content, resolved)
+	})
+}
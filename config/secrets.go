@@ -0,0 +1,146 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretRef returns the reference of a field tagged with a secret to bind, e.g. `secret:"prod/db#password"`.
+// Fields tagged with `secret:"true"` are only masked by Describe and have no reference.
+func secretRef(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("secret")
+	if tag == "" || tag == "true" || tag == "false" {
+		return "", false
+	}
+
+	return tag, true
+}
+
+// BindSecrets sets every field tagged with a secret reference, e.g. `secret:"prod/db#password"`, to the value
+// resolved by the resolver, selecting the key of a JSON object value after a #. All the secrets are resolved
+// with a single call to the resolver, and the fields of nested structs are bound as well. Fields tagged with
+// `secret:"true"` are not bound. Every secret that can't be bound is reported in the returned error.
+func BindSecrets(ctx context.Context, cfg any, resolver Resolver) error {
+	target, err := structValue(cfg)
+	if err != nil {
+		return err
+	}
+
+	fields := map[string][]reflect.Value{}
+	collectSecretFields(target, fields)
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	refs := map[string]bool{}
+	for ref := range fields {
+		refs[baseRef(ref)] = true
+	}
+
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	values, err := resolver.Resolve(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for ref, refFields := range fields {
+		value, err := lookup(values, ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not bind secret %s: %w", ref, err))
+			continue
+		}
+
+		for _, field := range refFields {
+			if err := setValue(field, value); err != nil {
+				errs = append(errs, fmt.Errorf("could not bind secret %s: %w", ref, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SecretPaths returns the paths of the fields of cfg, which must be a pointer to a struct, that are tagged with a
+// secret reference and set by BindSecrets, e.g. "Broker.Password". It helps implement SourceLoader.
+func SecretPaths(cfg any) ([]string, error) {
+	value, err := structValue(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	secretPaths(value.Type(), "", &paths)
+
+	return paths, nil
+}
+
+func secretPaths(typ reflect.Type, path string, paths *[]string) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldPath := joinPath(path, field.Name)
+
+		if _, ok := secretRef(field); ok {
+			*paths = append(*paths, fieldPath)
+			continue
+		}
+
+		if isNested(field.Type) {
+			secretPaths(field.Type, fieldPath, paths)
+		}
+	}
+}
+
+func collectSecretFields(value reflect.Value, fields map[string][]reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if ref, ok := secretRef(field); ok {
+			fields[ref] = append(fields[ref], value.Field(i))
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Pointer && !fieldValue.IsNil() {
+			fieldValue = fieldValue.Elem()
+		}
+
+		if isNested(fieldValue.Type()) {
+			collectSecretFields(fieldValue, fields)
+		}
+	}
+}
+
+// setValue sets a string or []byte field to the value and parses it as YAML into any other field.
+func setValue(field reflect.Value, value string) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8:
+		field.SetBytes([]byte(value))
+	default:
+		return yaml.Unmarshal([]byte(value), field.Addr().Interface())
+	}
+
+	return nil
+}